@@ -32,7 +32,8 @@ func NewDumpCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "dump",
 		Short: "Dump messages from a RabbitMQ queue",
-		Long:  "Dump messages from a specified RabbitMQ queue with flexible filtering and output options.",
+		Long: `Dump messages from a specified RabbitMQ queue with flexible filtering and output options.
+The queue must already exist: it is only inspected, never created or changed, unless --declare is given.`,
 		Example: `  # Dump messages from a queue to file
   goq dump -q "my_queue" -o messages.json -p
 
@@ -40,9 +41,18 @@ func NewDumpCmd() *cobra.Command {
   goq dump -q "orders" -a -i "urgent" -o urgent_orders.log
 
   # Dump from secure connection with full message details
-  goq dump -q "events" -s -k -f -o events_full.json`,
+  goq dump -q "events" -s -k -f -o events_full.json
+
+  # Dump until the queue has been quiet for 10 seconds
+  goq dump -q "orders" --idle-timeout 10s -o orders.json
+
+  # Drain a large queue 500 messages at a time, as a low priority consumer named in the management UI
+  goq dump -q "orders" -a --prefetch 500 --consumer-tag goq-drain --consumer-priority -1 -o orders.json
+
+  # Read a stream queue from the beginning up to a point in time
+  goq dump --stream -q "events" --offset first --until 2024-06-01T00:00:00Z -o events.json`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return app.Dump(config.CreateCommonConfig(cmd))
+			return app.Dump(cmd.Context(), config.CreateCommonConfig(cmd))
 		},
 	}
 
@@ -50,6 +60,19 @@ func NewDumpCmd() *cobra.Command {
 	cmd.Flags().BoolP("auto-ack", "a", false, "Automatically acknowledge messages")
 	cmd.Flags().BoolP("stop-after-consume", "c", false, "Stop after consuming messages")
 	cmd.Flags().BoolP("full-message", "f", false, "Print complete message details")
+	cmd.Flags().Bool("declare", false, "Declare the queue (durable) if it does not exist instead of only inspecting it")
+	cmd.Flags().StringToString("declare-arg", nil, "Queue argument used with --declare, e.g. x-queue-type=quorum (repeatable)")
+	cmd.Flags().Int("prefetch", 0, "Maximum unacknowledged deliveries in flight (0 picks the default: 10, or 250 with --auto-ack, 100 for streams)")
+	cmd.Flags().String("consumer-tag", "", "Consumer tag shown in the management UI (default: generated by the broker)")
+	cmd.Flags().Int("consumer-priority", 0, "Consumer priority (x-priority), higher priority consumers get messages first")
+	cmd.Flags().StringToString("consumer-arg", nil, "Consumer argument passed to basic.consume, e.g. x-cancel-on-ha-failover=true (repeatable)")
+	cmd.Flags().Bool("stream", false, "Read the queue as a RabbitMQ stream (non-destructive)")
+	cmd.Flags().String("offset", "first", "Stream offset to start from (first, last, next, <offset> or <RFC 3339 timestamp>)")
+	cmd.Flags().String("until", "", "Stop reading the stream after this offset or RFC 3339 timestamp (timestamps are compared with the timestamp property set by publishers, a message without it stops the read)")
+	cmd.Flags().Int("max-messages", 0, "Stop after writing this many messages (0 for no limit)")
+	cmd.Flags().Int("max-consumed", 0, "Stop after consuming this many messages, filtered or not (0 for no limit)")
+	cmd.Flags().Duration("idle-timeout", 0, "Stop when no message arrives for this long, e.g. 30s (0 to wait forever)")
+	cmd.Flags().Duration("duration", 0, "Stop after running for this long, e.g. 5m (0 to run until interrupted)")
 	cmd.MarkFlagRequired("queue")
 
 	return cmd
@@ -33,7 +33,11 @@ func NewMonitorCmd() *cobra.Command {
 		Use:     "monitor",
 		Aliases: []string{"mon"},
 		Short:   "Monitor RabbitMQ messages using routing keys",
-		Long:    "Monitor RabbitMQ messages by consuming from a temporary queue with specified routing keys.",
+		Long: `Monitor RabbitMQ messages by consuming from a temporary queue with specified routing keys.
+
+The temporary queue goes away with the connection. When the connection drops, goq reconnects with
+a growing backoff, declares the queue and its bindings again and writes a gap marker (routing key
+goq.gap) with the outage duration, since messages published meanwhile were missed.`,
 		Example: `  # Monitor all messages from an exchange
   goq monitor -K "#" -e "my_exchange" -w console -p
 
@@ -41,14 +45,37 @@ func NewMonitorCmd() *cobra.Command {
   goq monitor -K "user.created,user.updated" -e "events" -i "admin" -o users.log
 
   # Monitor with secure connection
-  goq monitor -K "order.*" -e "orders" -s -k -u "rabbitmq.example.com:5671"`,
+  goq monitor -K "order.*" -e "orders" -s -k -u "rabbitmq.example.com:5671"
+
+  # Monitor a broker that requires client certificates
+  goq monitor -K "order.*" -e "orders" -s -u "rabbitmq.example.com:5671" --tls-ca ca.pem --tls-cert client.pem --tls-key client-key.pem --auth-mechanism external
+
+  # Capture at most 100 messages and give up after 2 minutes, for scripts and CI
+  goq monitor -K "#" -e "events" --max-messages 100 --duration 2m -o events.json
+
+  # Run for days, starting a compressed file every 100MB or hour and keeping the last 48
+  goq monitor -K "#" -e "events" -o 'events-{time}.json' --rotate-size 100MB --rotate-every 1h --rotate-keep 48 --rotate-compress zstd
+
+  # One file per routing key
+  goq monitor -K "#" -e "events" --split-by routingKey -o 'out/{{.Key}}.ndjson'
+
+  # One-line summaries on the console
+  goq monitor -K "order.*" -e "orders" -w console --format 'template={{.Timestamp | formatTime "15:04:05"}} {{green .RoutingKey}} {{.Body.orderId}}'`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return app.Monitor(config.CreateCommonConfig(cmd))
+			return app.Monitor(cmd.Context(), config.CreateCommonConfig(cmd))
 		},
 	}
 
 	cmd.Flags().StringSliceP("routing-keys", "K", nil, "List of routing keys to monitor (required)")
 	cmd.Flags().BoolP("auto-ack", "a", false, "Automatically acknowledge messages")
+	cmd.Flags().Int("prefetch", 0, "Maximum unacknowledged deliveries in flight (0 picks the default: 250)")
+	cmd.Flags().String("consumer-tag", "", "Consumer tag shown in the management UI (default: generated by the broker)")
+	cmd.Flags().Int("consumer-priority", 0, "Consumer priority (x-priority), higher priority consumers get messages first")
+	cmd.Flags().StringToString("consumer-arg", nil, "Consumer argument passed to basic.consume, e.g. x-cancel-on-ha-failover=true (repeatable)")
+	cmd.Flags().Int("max-messages", 0, "Stop after writing this many messages (0 for no limit)")
+	cmd.Flags().Int("max-consumed", 0, "Stop after consuming this many messages, filtered or not (0 for no limit)")
+	cmd.Flags().Duration("idle-timeout", 0, "Stop when no message arrives for this long, e.g. 30s (0 to wait forever)")
+	cmd.Flags().Duration("duration", 0, "Stop after running for this long, e.g. 5m (0 to run until interrupted)")
 	cmd.MarkFlagRequired("routing-keys")
 
 	return cmd
@@ -0,0 +1,72 @@
+/*
+Copyright © 2024 Mariano Zunino <marianoz@posteo.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	app "github.com/marianozunino/goq/internal"
+	"github.com/marianozunino/goq/pkg/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// NewMoveCmd creates the `move` command.
+func NewMoveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "move",
+		Short: "Move messages between queues with filtering",
+		Long: `Move the messages of a queue that pass the filters to another exchange or queue.
+Each matching message is published with publisher confirms before it is acknowledged at the source.
+Messages that do not match stay in the source queue. A message the broker cannot route, e.g. to a
+queue that does not exist, is returned: the move stops and the message stays in the source queue.`,
+		Example: `  # Move retryable messages from a dead-letter queue back to the orders exchange
+  goq move --from orders.dlq --to-exchange orders --filter-json '.body.retryable'
+
+  # Move everything from a dead-letter queue straight into the work queue
+  goq move --from orders.dlq --to-queue orders
+
+  # Only report what would be moved
+  goq move --from orders.dlq --to-exchange orders -i "timeout" --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.Move(cmd.Context(), config.CreateCommonConfig(cmd))
+		},
+	}
+
+	// --filter-json reads more naturally next to --from/--to-exchange
+	cmd.SetGlobalNormalizationFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "filter-json" {
+			name = "json-filter"
+		}
+		return pflag.NormalizedName(name)
+	})
+
+	cmd.Flags().String("from", "", "Source queue name (required)")
+	cmd.Flags().String("to-exchange", "", "Exchange to publish the moved messages to")
+	cmd.Flags().String("to-queue", "", "Queue to publish the moved messages to (through the default exchange)")
+	cmd.Flags().String("to-routing-key", "", "Routing key for the moved messages (default: original routing key)")
+	cmd.Flags().Bool("dry-run", false, "Only report which messages would be moved")
+	cmd.MarkFlagRequired("from")
+	cmd.MarkFlagsOneRequired("to-exchange", "to-queue")
+	cmd.MarkFlagsMutuallyExclusive("to-exchange", "to-queue")
+	cmd.MarkFlagsMutuallyExclusive("to-queue", "to-routing-key")
+
+	return cmd
+}
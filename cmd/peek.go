@@ -0,0 +1,54 @@
+/*
+Copyright © 2024 Mariano Zunino <marianoz@posteo.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	app "github.com/marianozunino/goq/internal"
+	"github.com/marianozunino/goq/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// NewPeekCmd creates the `peek` command.
+func NewPeekCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "peek",
+		Short: "Peek at messages in a RabbitMQ queue without consuming them",
+		Long: `Peek at the first messages of a RabbitMQ queue using basic.get.
+All messages are held unacknowledged until the whole batch is read and then released at once,
+so the queue keeps its original order and no message is read twice.`,
+		Example: `  # Peek at the first 50 messages of a queue
+  goq peek -q "orders" -n 50 -w console -p
+
+  # Peek with full message details and save them to a file
+  goq peek -q "events" -n 10 -f -o events_peek.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.Peek(cmd.Context(), config.CreateCommonConfig(cmd))
+		},
+	}
+
+	cmd.Flags().StringP("queue", "q", "", "RabbitMQ queue name (required)")
+	cmd.Flags().IntP("count", "n", 10, "Number of messages to peek from the head of the queue")
+	cmd.Flags().BoolP("full-message", "f", false, "Print complete message details")
+	cmd.MarkFlagRequired("queue")
+
+	return cmd
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2024 Mariano Zunino <marianoz@posteo.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	app "github.com/marianozunino/goq/internal"
+	"github.com/marianozunino/goq/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// NewReplayCmd creates the `replay` command.
+func NewReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "replay",
+		Aliases: []string{"publish"},
+		Short:   "Re-publish dumped messages back to RabbitMQ",
+		Long: `Re-publish messages from a goq dump file back to RabbitMQ.
+Each message is published with its original headers, exchange and routing key,
+and with all AMQP properties when the dump was taken with --full-message.
+The recorded exchange is only replaced with -e/--exchange on the command line, an exchange set in the
+config file does not redirect a replay.
+Decoded bodies are encoded back to the format recorded in the dump (the x-goq-codec header, or the content-type
+with --full-message), whatever --codec says. Avro bodies use the writer schema recorded in the x-goq-schema header.
+Protobuf bodies are encoded with the type recorded in the x-goq-proto-type header and the --proto-descriptor
+set they were dumped with. None of these headers is published.
+Gap markers written by monitor (header x-goq-gap) are skipped and counted.`,
+		Example: `  # Replay a dump to the exchanges it was read from
+  goq replay -I messages.json
+
+  # Replay to another exchange with a fixed routing key, 100 messages per second
+  goq replay -I messages.json -e "orders" --routing-key-override "order.retry" --rate 100/s`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.CreateCommonConfig(cmd)
+			if cmd.Flags().Changed("exchange") {
+				cfg.TargetExchange = cfg.Exchange
+			}
+			return app.Replay(cmd.Context(), cfg)
+		},
+	}
+
+	cmd.Flags().StringP("input", "I", "", "Dump file to replay (required)")
+	cmd.Flags().String("routing-key-override", "", "Publish every message with this routing key")
+	cmd.Flags().String("rate", "", "Maximum publish rate, e.g. 100/s, 600/m (default unlimited)")
+	cmd.MarkFlagRequired("input")
+
+	return cmd
+}
@@ -21,7 +21,10 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/fatih/color"
 	"github.com/marianozunino/goq/pkg/config"
@@ -31,7 +34,7 @@ import (
 
 var (
 	cfgFile        string
-	validWriters   = []string{"file", "console"}
+	validWriters   = []string{"file", "console", "csv", "tsv", "sqlite"}
 	validFileModes = []string{"append", "overwrite"}
 	logo           = `
   ______    ______    ______
@@ -48,11 +51,17 @@ var RootCmd = &cobra.Command{
 
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		switch cmd.Use {
-		case "dump", "monitor":
+		case "dump", "monitor", "peek":
 			if err := validation.ValidateInput(); err != nil {
 				color.Red("Validation error: %v", err)
 				os.Exit(1)
 			}
+		case "replay", "move":
+			// Nothing is exported, so the writer and output settings do not apply
+			if err := validation.ValidatePublishInput(); err != nil {
+				color.Red("Validation error: %v", err)
+				os.Exit(1)
+			}
 		}
 		return nil
 	},
@@ -65,12 +74,43 @@ func init() {
 		ID:    "available-commands",
 		Title: "Available Commands:",
 	})
-	RootCmd.AddCommand(NewDumpCmd(), NewMonitorCmd(), NewConfigureCommand(), NewUpdateCmd())
+	RootCmd.AddCommand(NewDumpCmd(), NewMonitorCmd(), NewPeekCmd(), NewReplayCmd(), NewMoveCmd(), NewConfigureCommand(), NewUpdateCmd())
 }
 
 func Execute() {
-	if err := RootCmd.Execute(); err != nil {
+	ctx, sig := notifyShutdown()
+
+	if err := RootCmd.ExecuteContext(ctx); err != nil {
 		color.Red("Error: %v", err)
 		os.Exit(1)
 	}
+
+	// Follow the shell convention of 128 + signal number for interrupted runs
+	select {
+	case s := <-sig:
+		if n, ok := s.(syscall.Signal); ok {
+			os.Exit(128 + int(n))
+		}
+		os.Exit(1)
+	default:
+	}
+}
+
+// notifyShutdown returns a context that is cancelled on the first SIGINT or
+// SIGTERM, together with a channel that then holds the received signal.
+// A second signal terminates the process immediately.
+func notifyShutdown() (context.Context, <-chan os.Signal) {
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan os.Signal, 1)
+	notify := make(chan os.Signal, 1)
+	signal.Notify(notify, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		s := <-notify
+		signal.Stop(notify)
+		received <- s
+		cancel()
+	}()
+
+	return ctx, received
 }
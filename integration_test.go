@@ -13,13 +13,7 @@ import (
 func TestIntegration_FilterAndExport(t *testing.T) {
 	// Create a test configuration
 	cfg := &config.Config{
-		FilterConfig: struct {
-			IncludePatterns []string
-			ExcludePatterns []string
-			JSONFilter      string
-			MaxMessageSize  int
-			RegexFilter     string
-		}{
+		FilterConfig: config.FilterConfig{
 			IncludePatterns: []string{"admin"},
 			ExcludePatterns: []string{"debug"},
 			JSONFilter:      "",
@@ -70,13 +64,7 @@ func TestIntegration_FilterAndExport(t *testing.T) {
 func TestIntegration_JSONFilterAndExport(t *testing.T) {
 	// Create a test configuration with JSON filter
 	cfg := &config.Config{
-		FilterConfig: struct {
-			IncludePatterns []string
-			ExcludePatterns []string
-			JSONFilter      string
-			MaxMessageSize  int
-			RegexFilter     string
-		}{
+		FilterConfig: config.FilterConfig{
 			IncludePatterns: []string{},
 			ExcludePatterns: []string{},
 			JSONFilter:      `.user.role == "admin"`,
@@ -259,13 +247,7 @@ func TestIntegration_ErrorHandling(t *testing.T) {
 
 	// Test invalid JSON filter
 	cfg3 := &config.Config{
-		FilterConfig: struct {
-			IncludePatterns []string
-			ExcludePatterns []string
-			JSONFilter      string
-			MaxMessageSize  int
-			RegexFilter     string
-		}{
+		FilterConfig: config.FilterConfig{
 			IncludePatterns: []string{},
 			ExcludePatterns: []string{},
 			JSONFilter:      "invalid jq syntax",
@@ -281,11 +263,20 @@ func TestIntegration_ErrorHandling(t *testing.T) {
 	}
 }
 
-// testMessage implements filter.MessageDelivery interface for testing
+// testMessage implements filter.MessageDelivery interface for testing. The
+// payload defaults to the body when not set.
 type testMessage struct {
-	body []byte
+	body    []byte
+	payload []byte
 }
 
 func (t *testMessage) GetBody() []byte {
 	return t.body
 }
+
+func (t *testMessage) GetPayload() []byte {
+	if t.payload == nil {
+		return t.body
+	}
+	return t.payload
+}
@@ -0,0 +1,183 @@
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported content encodings
+const (
+	Gzip    = "gzip"
+	Deflate = "deflate"
+	Zstd    = "zstd"
+	Snappy  = "snappy"
+)
+
+// MaxSize is the largest payload a body is decompressed to. A small message
+// can expand to gigabytes, so a body that would be larger is kept compressed.
+const MaxSize = 256 << 20
+
+// ErrTooLarge is returned for a body that decompresses to more than MaxSize
+var ErrTooLarge = errors.New("decompressed body is too large")
+
+// zstdDecoder is shared, a zstd decoder is costly to set up and DecodeAll is
+// safe for concurrent use. Its memory is bounded by MaxSize.
+var zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+	return zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(MaxSize))
+})
+
+var (
+	gzipMagic         = []byte{0x1f, 0x8b}
+	zstdMagic         = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	snappyFramedMagic = []byte{0xff, 0x06, 0x00, 0x00, 's', 'N', 'a', 'P', 'p', 'Y'}
+)
+
+// Normalize maps a content-encoding property to one of the supported
+// encodings, or returns an empty string when the body is not compressed
+// or uses an encoding goq does not know about
+func Normalize(contentEncoding string) string {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "gzip", "x-gzip":
+		return Gzip
+	case "deflate", "zlib":
+		return Deflate
+	case "zstd", "zstandard":
+		return Zstd
+	case "snappy", "x-snappy", "x-snappy-framed":
+		return Snappy
+	default:
+		return ""
+	}
+}
+
+// Sniff detects the compression of a body from its magic bytes. Raw snappy
+// blocks have no signature and are only recognized by content-encoding.
+func Sniff(body []byte) string {
+	switch {
+	case bytes.HasPrefix(body, gzipMagic):
+		return Gzip
+	case bytes.HasPrefix(body, zstdMagic):
+		return Zstd
+	case bytes.HasPrefix(body, snappyFramedMagic):
+		return Snappy
+	case isZlibHeader(body):
+		return Deflate
+	default:
+		return ""
+	}
+}
+
+// Decompress decodes a body according to its content-encoding property, or
+// its magic bytes when the property is missing. It returns the payload, the
+// encoding that was removed (empty when the body was left untouched) and an
+// error when a body that claims to be compressed can't be decoded or would
+// be larger than MaxSize.
+func Decompress(contentEncoding string, body []byte) ([]byte, string, error) {
+	return decompress(contentEncoding, body, MaxSize)
+}
+
+func decompress(contentEncoding string, body []byte, limit int64) ([]byte, string, error) {
+	encoding := Normalize(contentEncoding)
+	sniffed := false
+	if encoding == "" {
+		if strings.TrimSpace(contentEncoding) != "" {
+			// Some other encoding, e.g. a charset set by mistake
+			return body, "", nil
+		}
+		encoding = Sniff(body)
+		sniffed = true
+	}
+	if encoding == "" {
+		return body, "", nil
+	}
+
+	decoded, err := decode(encoding, body, limit)
+	if err != nil {
+		if sniffed && !errors.Is(err, ErrTooLarge) {
+			// The magic bytes were a coincidence, keep the body as is
+			return body, "", nil
+		}
+		return body, "", fmt.Errorf("failed to decompress %s body: %w", encoding, err)
+	}
+	return decoded, encoding, nil
+}
+
+func decode(encoding string, body []byte, limit int64) ([]byte, error) {
+	switch encoding {
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return readAll(r, limit)
+	case Deflate:
+		// deflate is zlib wrapped per HTTP, but raw streams are common too
+		if isZlibHeader(body) {
+			r, err := zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return readAll(r, limit)
+		}
+		r := flate.NewReader(bytes.NewReader(body))
+		defer r.Close()
+		return readAll(r, limit)
+	case Zstd:
+		d, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := d.DecodeAll(body, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) || int64(len(decoded)) > limit {
+			return nil, tooLarge(limit)
+		}
+		return decoded, err
+	case Snappy:
+		if bytes.HasPrefix(body, snappyFramedMagic) {
+			return readAll(snappy.NewReader(bytes.NewReader(body)), limit)
+		}
+		if n, err := snappy.DecodedLen(body); err == nil && int64(n) > limit {
+			return nil, tooLarge(limit)
+		}
+		return snappy.Decode(nil, body)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+// readAll reads r up to limit bytes, failing with ErrTooLarge past it
+func readAll(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, tooLarge(limit)
+	}
+	return data, nil
+}
+
+func tooLarge(limit int64) error {
+	return fmt.Errorf("%w (more than %d bytes)", ErrTooLarge, limit)
+}
+
+// isZlibHeader checks the CMF/FLG pair of a zlib stream using deflate with a
+// 32K window, as written by every common zlib implementation
+func isZlibHeader(body []byte) bool {
+	if len(body) < 2 || body[0] != 0x78 {
+		return false
+	}
+	return (uint16(body[0])<<8|uint16(body[1]))%31 == 0
+}
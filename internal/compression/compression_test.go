@@ -0,0 +1,195 @@
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+var payload = []byte(`{"order": 42, "items": ["a", "b", "c"]}`)
+
+func gzipBody(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(payload)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to gzip payload: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func zlibBody(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(payload)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to zlib payload: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func flateBody(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write(payload)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to deflate payload: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBody(t *testing.T) []byte {
+	w, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("Failed to create zstd writer: %v", err)
+	}
+	defer w.Close()
+	return w.EncodeAll(payload, nil)
+}
+
+func snappyFramedBody(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := snappy.NewBufferedWriter(&buf)
+	w.Write(payload)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to snappy payload: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress_ByContentEncoding(t *testing.T) {
+	tests := []struct {
+		name            string
+		contentEncoding string
+		body            []byte
+		expected        string
+	}{
+		{name: "gzip", contentEncoding: "gzip", body: gzipBody(t), expected: Gzip},
+		{name: "x-gzip", contentEncoding: "x-gzip", body: gzipBody(t), expected: Gzip},
+		{name: "deflate zlib", contentEncoding: "deflate", body: zlibBody(t), expected: Deflate},
+		{name: "deflate raw", contentEncoding: "deflate", body: flateBody(t), expected: Deflate},
+		{name: "zstd", contentEncoding: "zstd", body: zstdBody(t), expected: Zstd},
+		{name: "snappy block", contentEncoding: "snappy", body: snappy.Encode(nil, payload), expected: Snappy},
+		{name: "snappy framed", contentEncoding: "x-snappy-framed", body: snappyFramedBody(t), expected: Snappy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, encoding, err := Decompress(tt.contentEncoding, tt.body)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if encoding != tt.expected {
+				t.Errorf("Expected encoding %q, got %q", tt.expected, encoding)
+			}
+			if !bytes.Equal(body, payload) {
+				t.Errorf("Expected decompressed payload, got %q", body)
+			}
+		})
+	}
+}
+
+func TestDecompress_Sniffed(t *testing.T) {
+	bodies := map[string][]byte{
+		Gzip:    gzipBody(t),
+		Deflate: zlibBody(t),
+		Zstd:    zstdBody(t),
+		Snappy:  snappyFramedBody(t),
+	}
+
+	for expected, compressed := range bodies {
+		t.Run(expected, func(t *testing.T) {
+			body, encoding, err := Decompress("", compressed)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if encoding != expected {
+				t.Errorf("Expected sniffed encoding %q, got %q", expected, encoding)
+			}
+			if !bytes.Equal(body, payload) {
+				t.Errorf("Expected decompressed payload, got %q", body)
+			}
+		})
+	}
+}
+
+func TestDecompress_Untouched(t *testing.T) {
+	tests := []struct {
+		name            string
+		contentEncoding string
+		body            []byte
+	}{
+		{name: "plain JSON", body: payload},
+		{name: "text starting like zlib", body: []byte("x^2 + y^2")},
+		{name: "gzip magic only", body: []byte{0x1f, 0x8b, 0x00}},
+		{name: "charset as encoding", contentEncoding: "utf-8", body: gzipBody(t)},
+		{name: "identity", contentEncoding: "identity", body: payload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, encoding, err := Decompress(tt.contentEncoding, tt.body)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if encoding != "" {
+				t.Errorf("Expected body to be left untouched, got encoding %q", encoding)
+			}
+			if !bytes.Equal(body, tt.body) {
+				t.Error("Expected original body")
+			}
+		})
+	}
+}
+
+func TestDecompress_CorruptBody(t *testing.T) {
+	corrupt := []byte("definitely not gzip")
+
+	body, encoding, err := Decompress("gzip", corrupt)
+	if err == nil {
+		t.Error("Expected error for a corrupt gzip body")
+	}
+	if encoding != "" || !bytes.Equal(body, corrupt) {
+		t.Error("Expected the original body back on error")
+	}
+}
+
+func TestDecompress_TooLarge(t *testing.T) {
+	limit := int64(len(payload) - 1)
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{name: "gzip", encoding: "gzip", body: gzipBody(t)},
+		{name: "zlib", encoding: "deflate", body: zlibBody(t)},
+		{name: "raw deflate", encoding: "deflate", body: flateBody(t)},
+		{name: "zstd", encoding: "zstd", body: zstdBody(t)},
+		{name: "snappy framed", encoding: "snappy", body: snappyFramedBody(t)},
+		{name: "snappy block", encoding: "snappy", body: snappy.Encode(nil, payload)},
+		{name: "sniffed gzip", encoding: "", body: gzipBody(t)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, encoding, err := decompress(tt.encoding, tt.body, limit)
+			if !errors.Is(err, ErrTooLarge) {
+				t.Errorf("Expected ErrTooLarge, got %v", err)
+			}
+			if encoding != "" || !bytes.Equal(body, tt.body) {
+				t.Error("Expected the body to be kept compressed")
+			}
+
+			// At the limit the body is decompressed
+			if body, _, err := decompress(tt.encoding, tt.body, int64(len(payload))); err != nil || !bytes.Equal(body, payload) {
+				t.Errorf("Expected a body of exactly the limit to be decompressed, got %q, %v", body, err)
+			}
+		})
+	}
+}
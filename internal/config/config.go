@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -12,9 +13,25 @@ type ExporterKind string
 const (
 	ConsoleExporterKind ExporterKind = "console"
 	FileWriterKind      ExporterKind = "file"
+	CSVExporterKind     ExporterKind = "csv"
+	TSVExporterKind     ExporterKind = "tsv"
+	SQLiteExporterKind  ExporterKind = "sqlite"
+)
+
+// What a fan-out does when one of its outputs fails, see --on-output-error
+const (
+	OutputErrorsContinue = "continue"
+	OutputErrorsFail     = "fail"
+)
+
+// SASL mechanisms accepted by --auth-mechanism
+const (
+	AuthMechanismPlain    = "plain"
+	AuthMechanismExternal = "external"
 )
 
 type Config struct {
+	Command             string
 	RabbitMQURL         string
 	Exchange            string
 	Queue               string
@@ -23,19 +40,94 @@ type Config struct {
 	FileMode            string
 	VirtualHost         string
 	SkipTLSVerification bool
+	TLSCA               string
+	TLSCert             string
+	TLSKey              string
+	TLSServerName       string
+	AuthMechanism       string
+	Heartbeat           time.Duration
 	AutoAck             bool
 	StopAfterConsume    bool
 	RoutingKeys         []string
 	PrettyPrint         bool
 	FullMessage         bool
+	PeekCount           int
+	InputFile           string
+	RoutingKeyOverride  string
+	PublishRate         string
+	TargetExchange      string
+	TargetQueue         string
+	TargetRoutingKey    string
+	DryRun              bool
+	Stream              bool
+	StreamOffset        string
+	StreamUntil         string
+	DeclareQueue        bool
+	DeclareArgs         map[string]string
+	Prefetch            int
+	ConsumerTag         string
+	ConsumerPriority    int
+	ConsumerArgs        map[string]string
+	MaxMessages         int
+	MaxConsumed         int
+	IdleTimeout         time.Duration
+	Duration            time.Duration
+	KeepCompressed      bool
+	ProtoDescriptors    []string
+	ProtoType           string
+	ProtoMappings       []ProtoMapping
+	Codec               string
+	AvroSchemas         []string
+	Columns             string
+	RotateSize          string
+	RotateEvery         time.Duration
+	RotateKeep          int
+	RotateCompress      string
+	SplitBy             string
+	SplitMaxOpen        int
+	Outputs             []OutputConfig
+	OutputErrors        string
+	Format              string
+	TemplateFile        string
 
-	FilterConfig struct {
-		IncludePatterns []string
-		ExcludePatterns []string
-		JSONFilter      string
-		MaxMessageSize  int
-		RegexFilter     string
-	}
+	FilterConfig FilterConfig
+}
+
+// FilterConfig holds the settings of the message filters
+type FilterConfig struct {
+	IncludePatterns []string
+	ExcludePatterns []string
+	JSONFilter      string
+	MaxMessageSize  int
+	RegexFilter     string
+	HeaderFilters   []string
+	RoutingKeyRegex string
+	Transform       string
+}
+
+// ProtoMapping selects the protobuf message type of a delivery, either by a
+// routing key regex or by a header. A header mapping without a type takes
+// the type name from the header value.
+type ProtoMapping struct {
+	RoutingKey string `mapstructure:"routing-key"`
+	Header     string `mapstructure:"header"`
+	Value      string `mapstructure:"value"`
+	Type       string `mapstructure:"type"`
+}
+
+// OutputConfig is one sink of a fan-out to several writers, as listed under
+// outputs in the config file. Options left unset inherit the command line
+// ones.
+type OutputConfig struct {
+	Writer       string `mapstructure:"writer"`
+	Output       string `mapstructure:"output"`
+	FileMode     string `mapstructure:"file-mode"`
+	PrettyPrint  *bool  `mapstructure:"pretty-print"`
+	FullMessage  *bool  `mapstructure:"full-message"`
+	Columns      string `mapstructure:"columns"`
+	Transform    string `mapstructure:"transform"`
+	Format       string `mapstructure:"format"`
+	TemplateFile string `mapstructure:"template-file"`
 }
 
 type Option func(*Config)
@@ -76,6 +168,48 @@ func WithSkipTLSVerification(skip bool) Option {
 	}
 }
 
+func WithCommand(command string) Option {
+	return func(c *Config) {
+		c.Command = command
+	}
+}
+
+func WithHeartbeat(heartbeat time.Duration) Option {
+	return func(c *Config) {
+		c.Heartbeat = heartbeat
+	}
+}
+
+func WithTLSCA(path string) Option {
+	return func(c *Config) {
+		c.TLSCA = path
+	}
+}
+
+func WithTLSCert(path string) Option {
+	return func(c *Config) {
+		c.TLSCert = path
+	}
+}
+
+func WithTLSKey(path string) Option {
+	return func(c *Config) {
+		c.TLSKey = path
+	}
+}
+
+func WithTLSServerName(name string) Option {
+	return func(c *Config) {
+		c.TLSServerName = name
+	}
+}
+
+func WithAuthMechanism(mechanism string) Option {
+	return func(c *Config) {
+		c.AuthMechanism = mechanism
+	}
+}
+
 func WithAutoAck(autoAck bool) Option {
 	return func(c *Config) {
 		c.AutoAck = autoAck
@@ -144,6 +278,252 @@ func WithFullMessage(fullMessage bool) Option {
 	}
 }
 
+func WithPeekCount(count int) Option {
+	return func(c *Config) {
+		c.PeekCount = count
+	}
+}
+
+func WithInputFile(inputFile string) Option {
+	return func(c *Config) {
+		c.InputFile = inputFile
+	}
+}
+
+func WithRoutingKeyOverride(routingKey string) Option {
+	return func(c *Config) {
+		c.RoutingKeyOverride = routingKey
+	}
+}
+
+func WithPublishRate(rate string) Option {
+	return func(c *Config) {
+		c.PublishRate = rate
+	}
+}
+
+func WithTargetExchange(exchange string) Option {
+	return func(c *Config) {
+		c.TargetExchange = exchange
+	}
+}
+
+func WithTargetQueue(queue string) Option {
+	return func(c *Config) {
+		c.TargetQueue = queue
+	}
+}
+
+func WithTargetRoutingKey(routingKey string) Option {
+	return func(c *Config) {
+		c.TargetRoutingKey = routingKey
+	}
+}
+
+func WithDryRun(dryRun bool) Option {
+	return func(c *Config) {
+		c.DryRun = dryRun
+	}
+}
+
+func WithStream(stream bool) Option {
+	return func(c *Config) {
+		c.Stream = stream
+	}
+}
+
+func WithStreamOffset(offset string) Option {
+	return func(c *Config) {
+		c.StreamOffset = offset
+	}
+}
+
+func WithStreamUntil(until string) Option {
+	return func(c *Config) {
+		c.StreamUntil = until
+	}
+}
+
+func WithDeclareQueue(declare bool) Option {
+	return func(c *Config) {
+		c.DeclareQueue = declare
+	}
+}
+
+func WithDeclareArgs(args map[string]string) Option {
+	return func(c *Config) {
+		c.DeclareArgs = args
+	}
+}
+
+func WithPrefetch(prefetch int) Option {
+	return func(c *Config) {
+		c.Prefetch = prefetch
+	}
+}
+
+func WithConsumerTag(tag string) Option {
+	return func(c *Config) {
+		c.ConsumerTag = tag
+	}
+}
+
+func WithConsumerPriority(priority int) Option {
+	return func(c *Config) {
+		c.ConsumerPriority = priority
+	}
+}
+
+func WithConsumerArgs(args map[string]string) Option {
+	return func(c *Config) {
+		c.ConsumerArgs = args
+	}
+}
+
+func WithHeaderFilters(headers []string) Option {
+	return func(c *Config) {
+		c.FilterConfig.HeaderFilters = headers
+	}
+}
+
+func WithRoutingKeyRegex(pattern string) Option {
+	return func(c *Config) {
+		c.FilterConfig.RoutingKeyRegex = pattern
+	}
+}
+
+func WithTransform(transform string) Option {
+	return func(c *Config) {
+		c.FilterConfig.Transform = transform
+	}
+}
+
+func WithMaxMessages(max int) Option {
+	return func(c *Config) {
+		c.MaxMessages = max
+	}
+}
+
+func WithMaxConsumed(max int) Option {
+	return func(c *Config) {
+		c.MaxConsumed = max
+	}
+}
+
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.IdleTimeout = timeout
+	}
+}
+
+func WithDuration(duration time.Duration) Option {
+	return func(c *Config) {
+		c.Duration = duration
+	}
+}
+
+func WithKeepCompressed(keep bool) Option {
+	return func(c *Config) {
+		c.KeepCompressed = keep
+	}
+}
+
+func WithProtoDescriptors(paths []string) Option {
+	return func(c *Config) {
+		c.ProtoDescriptors = paths
+	}
+}
+
+func WithProtoType(typeName string) Option {
+	return func(c *Config) {
+		c.ProtoType = typeName
+	}
+}
+
+func WithProtoMappings(mappings []ProtoMapping) Option {
+	return func(c *Config) {
+		c.ProtoMappings = mappings
+	}
+}
+
+func WithCodec(codec string) Option {
+	return func(c *Config) {
+		c.Codec = codec
+	}
+}
+
+func WithAvroSchemas(paths []string) Option {
+	return func(c *Config) {
+		c.AvroSchemas = paths
+	}
+}
+
+func WithColumns(columns string) Option {
+	return func(c *Config) {
+		c.Columns = columns
+	}
+}
+
+func WithRotateSize(size string) Option {
+	return func(c *Config) {
+		c.RotateSize = size
+	}
+}
+
+func WithRotateEvery(every time.Duration) Option {
+	return func(c *Config) {
+		c.RotateEvery = every
+	}
+}
+
+func WithRotateKeep(keep int) Option {
+	return func(c *Config) {
+		c.RotateKeep = keep
+	}
+}
+
+func WithRotateCompress(compress string) Option {
+	return func(c *Config) {
+		c.RotateCompress = compress
+	}
+}
+
+func WithSplitBy(splitBy string) Option {
+	return func(c *Config) {
+		c.SplitBy = splitBy
+	}
+}
+
+func WithSplitMaxOpen(maxOpen int) Option {
+	return func(c *Config) {
+		c.SplitMaxOpen = maxOpen
+	}
+}
+
+func WithOutputs(outputs []OutputConfig) Option {
+	return func(c *Config) {
+		c.Outputs = outputs
+	}
+}
+
+func WithOutputErrors(mode string) Option {
+	return func(c *Config) {
+		c.OutputErrors = mode
+	}
+}
+
+func WithFormat(format string) Option {
+	return func(c *Config) {
+		c.Format = format
+	}
+}
+
+func WithTemplateFile(path string) Option {
+	return func(c *Config) {
+		c.TemplateFile = path
+	}
+}
+
 func WithWriter(writer string) Option {
 	return func(c *Config) {
 		c.Writer = ExporterKind(writer)
@@ -151,11 +531,12 @@ func WithWriter(writer string) Option {
 }
 
 func New(options ...Option) *Config {
+	uri, _ := URIFromFlags()
 	c := &Config{
-		RabbitMQURL:         fmt.Sprintf("%s://%s/%s", getProtocol(), viper.GetString("url"), viper.GetString("virtualhost")),
+		RabbitMQURL:         uri,
 		Exchange:            viper.GetString("exchange"),
 		Queue:               viper.GetString("queue"),
-		Writer:              ExporterKind(viper.GetString("writer")),
+		Writer:              ExporterKind(primaryWriter()),
 		OutputFile:          viper.GetString("output"),
 		FileMode:            viper.GetString("file-mode"),
 		VirtualHost:         viper.GetString("virtualhost"),
@@ -166,13 +547,7 @@ func New(options ...Option) *Config {
 		PrettyPrint:         viper.GetBool("pretty-print"),
 		FullMessage:         viper.GetBool("full-message"),
 
-		FilterConfig: struct {
-			IncludePatterns []string
-			ExcludePatterns []string
-			JSONFilter      string
-			MaxMessageSize  int
-			RegexFilter     string
-		}{
+		FilterConfig: FilterConfig{
 			MaxMessageSize: -1, // Default: no size limit
 		},
 	}
@@ -184,6 +559,28 @@ func New(options ...Option) *Config {
 	return c
 }
 
+// HasWriter reports whether kind is the writer, or one of the outputs of a
+// fan-out
+func (c *Config) HasWriter(kind ExporterKind) bool {
+	if len(c.Outputs) == 0 {
+		return c.Writer == kind
+	}
+	for _, out := range c.Outputs {
+		if ExporterKind(out.Writer) == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// primaryWriter returns the first --writer, the flag may be repeated
+func primaryWriter() string {
+	if writers := viper.GetStringSlice("writer"); len(writers) > 0 {
+		return writers[0]
+	}
+	return ""
+}
+
 func (c *Config) PrintConfig() string {
 	return fmt.Sprintf(`RabbitMQ:
 	URL: %s
@@ -207,7 +604,7 @@ Filters:
 	Max Message Size: %s
 	Regex Filter: %s`,
 		// RabbitMQ Section
-		c.RabbitMQURL,
+		RedactURI(c.RabbitMQURL),
 		c.Exchange,
 		c.Queue,
 		c.VirtualHost,
@@ -221,9 +618,18 @@ Filters:
 			return strings.Join(c.RoutingKeys, ", ")
 		}(),
 		// Writer Section
-		c.Writer,
 		func() string {
-			if c.Writer == FileWriterKind {
+			if len(c.Outputs) == 0 {
+				return string(c.Writer)
+			}
+			writers := make([]string, len(c.Outputs))
+			for i, out := range c.Outputs {
+				writers[i] = out.Writer
+			}
+			return strings.Join(writers, ", ")
+		}(),
+		func() string {
+			if c.Writer != ConsoleExporterKind && c.OutputFile != "" {
 				return c.OutputFile
 			}
 			return "false"
@@ -264,10 +670,3 @@ Filters:
 		}(),
 	)
 }
-
-func getProtocol() string {
-	if viper.GetBool("secure") {
-		return "amqps"
-	}
-	return "amqp"
-}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 func TestWithVirtualHost(t *testing.T) {
@@ -204,3 +205,272 @@ func contains(s, substr string) bool {
 				s[len(s)-len(substr):] == substr ||
 				contains(s[1:], substr))))
 }
+
+func TestWithPeekCount(t *testing.T) {
+	config := New(WithPeekCount(50))
+
+	if config.PeekCount != 50 {
+		t.Errorf("Expected PeekCount 50, got %d", config.PeekCount)
+	}
+}
+
+func TestWithReplayOptions(t *testing.T) {
+	config := New(
+		WithInputFile("dump.json"),
+		WithRoutingKeyOverride("order.retry"),
+		WithPublishRate("100/s"),
+	)
+
+	if config.InputFile != "dump.json" {
+		t.Errorf("Expected InputFile dump.json, got %s", config.InputFile)
+	}
+
+	if config.RoutingKeyOverride != "order.retry" {
+		t.Errorf("Expected RoutingKeyOverride order.retry, got %s", config.RoutingKeyOverride)
+	}
+
+	if config.PublishRate != "100/s" {
+		t.Errorf("Expected PublishRate 100/s, got %s", config.PublishRate)
+	}
+}
+
+func TestWithMoveOptions(t *testing.T) {
+	config := New(
+		WithTargetExchange("orders"),
+		WithTargetQueue("orders.work"),
+		WithTargetRoutingKey("order.retry"),
+		WithDryRun(true),
+	)
+
+	if config.TargetExchange != "orders" {
+		t.Errorf("Expected TargetExchange orders, got %s", config.TargetExchange)
+	}
+
+	if config.TargetQueue != "orders.work" {
+		t.Errorf("Expected TargetQueue orders.work, got %s", config.TargetQueue)
+	}
+
+	if config.TargetRoutingKey != "order.retry" {
+		t.Errorf("Expected TargetRoutingKey order.retry, got %s", config.TargetRoutingKey)
+	}
+
+	if !config.DryRun {
+		t.Error("Expected DryRun to be true")
+	}
+}
+
+func TestWithStreamOptions(t *testing.T) {
+	config := New(
+		WithStream(true),
+		WithStreamOffset("first"),
+		WithStreamUntil("100"),
+	)
+
+	if !config.Stream {
+		t.Error("Expected Stream to be true")
+	}
+
+	if config.StreamOffset != "first" {
+		t.Errorf("Expected StreamOffset first, got %s", config.StreamOffset)
+	}
+
+	if config.StreamUntil != "100" {
+		t.Errorf("Expected StreamUntil 100, got %s", config.StreamUntil)
+	}
+}
+
+func TestWithDeclareOptions(t *testing.T) {
+	args := map[string]string{"x-queue-type": "quorum"}
+	config := New(WithDeclareQueue(true), WithDeclareArgs(args))
+
+	if !config.DeclareQueue {
+		t.Error("Expected DeclareQueue to be true")
+	}
+
+	if config.DeclareArgs["x-queue-type"] != "quorum" {
+		t.Errorf("Expected DeclareArgs to be set, got %v", config.DeclareArgs)
+	}
+}
+
+func TestNewConfig_PassiveByDefault(t *testing.T) {
+	config := New()
+
+	if config.DeclareQueue {
+		t.Error("Expected queues to be handled passively by default")
+	}
+}
+
+func TestWithLimitOptions(t *testing.T) {
+	config := New(
+		WithMaxMessages(100),
+		WithMaxConsumed(500),
+		WithIdleTimeout(30*time.Second),
+		WithDuration(5*time.Minute),
+	)
+
+	if config.MaxMessages != 100 {
+		t.Errorf("Expected MaxMessages 100, got %d", config.MaxMessages)
+	}
+
+	if config.MaxConsumed != 500 {
+		t.Errorf("Expected MaxConsumed 500, got %d", config.MaxConsumed)
+	}
+
+	if config.IdleTimeout != 30*time.Second {
+		t.Errorf("Expected IdleTimeout 30s, got %s", config.IdleTimeout)
+	}
+
+	if config.Duration != 5*time.Minute {
+		t.Errorf("Expected Duration 5m, got %s", config.Duration)
+	}
+}
+
+func TestWithDocumentFilterOptions(t *testing.T) {
+	config := New(
+		WithHeaderFilters([]string{"x-tenant=acme"}),
+		WithRoutingKeyRegex(`^orders\.`),
+	)
+
+	if len(config.FilterConfig.HeaderFilters) != 1 || config.FilterConfig.HeaderFilters[0] != "x-tenant=acme" {
+		t.Errorf("Expected HeaderFilters to be set, got %v", config.FilterConfig.HeaderFilters)
+	}
+
+	if config.FilterConfig.RoutingKeyRegex != `^orders\.` {
+		t.Errorf("Expected RoutingKeyRegex to be set, got %s", config.FilterConfig.RoutingKeyRegex)
+	}
+}
+
+func TestWithTransform(t *testing.T) {
+	config := New(WithTransform("{id: .body.id}"))
+
+	if config.FilterConfig.Transform != "{id: .body.id}" {
+		t.Errorf("Expected Transform to be set, got %s", config.FilterConfig.Transform)
+	}
+}
+
+func TestWithColumns(t *testing.T) {
+	config := New(WithColumns("id=.body.id,rk=.routingKey"))
+
+	if config.Columns != "id=.body.id,rk=.routingKey" {
+		t.Errorf("Expected Columns to be set, got %s", config.Columns)
+	}
+}
+
+func TestWithFormat(t *testing.T) {
+	config := New(WithFormat("template={{.RoutingKey}}"), WithTemplateFile("line.tmpl"))
+
+	if config.Format != "template={{.RoutingKey}}" {
+		t.Errorf("Expected Format to be set, got %s", config.Format)
+	}
+
+	if config.TemplateFile != "line.tmpl" {
+		t.Errorf("Expected TemplateFile to be set, got %s", config.TemplateFile)
+	}
+}
+
+func TestWithTLSOptions(t *testing.T) {
+	config := New(
+		WithTLSCA("ca.crt"),
+		WithTLSCert("client.crt"),
+		WithTLSKey("client.key"),
+		WithTLSServerName("rabbit.internal"),
+		WithAuthMechanism(AuthMechanismExternal),
+	)
+
+	if config.TLSCA != "ca.crt" || config.TLSCert != "client.crt" || config.TLSKey != "client.key" {
+		t.Errorf("Expected the TLS files to be set, got %s, %s, %s", config.TLSCA, config.TLSCert, config.TLSKey)
+	}
+
+	if config.TLSServerName != "rabbit.internal" {
+		t.Errorf("Expected TLSServerName to be set, got %s", config.TLSServerName)
+	}
+
+	if config.AuthMechanism != AuthMechanismExternal {
+		t.Errorf("Expected AuthMechanism external, got %s", config.AuthMechanism)
+	}
+}
+
+func TestWithConnectionOptions(t *testing.T) {
+	config := New(WithCommand("dump"), WithHeartbeat(30*time.Second))
+
+	if config.Command != "dump" {
+		t.Errorf("Expected Command dump, got %s", config.Command)
+	}
+
+	if config.Heartbeat != 30*time.Second {
+		t.Errorf("Expected Heartbeat 30s, got %v", config.Heartbeat)
+	}
+}
+
+func TestWithConsumerOptions(t *testing.T) {
+	config := New(
+		WithPrefetch(50),
+		WithConsumerTag("goq-audit"),
+		WithConsumerPriority(-5),
+		WithConsumerArgs(map[string]string{"x-cancel-on-ha-failover": "true"}),
+	)
+
+	if config.Prefetch != 50 {
+		t.Errorf("Expected Prefetch 50, got %d", config.Prefetch)
+	}
+
+	if config.ConsumerTag != "goq-audit" {
+		t.Errorf("Expected ConsumerTag goq-audit, got %s", config.ConsumerTag)
+	}
+
+	if config.ConsumerPriority != -5 {
+		t.Errorf("Expected ConsumerPriority -5, got %d", config.ConsumerPriority)
+	}
+
+	if config.ConsumerArgs["x-cancel-on-ha-failover"] != "true" {
+		t.Errorf("Expected ConsumerArgs to be set, got %v", config.ConsumerArgs)
+	}
+}
+
+func TestHasWriter(t *testing.T) {
+	single := New(WithWriter("file"), WithOutputs(nil))
+	if !single.HasWriter(FileWriterKind) || single.HasWriter(ConsoleExporterKind) {
+		t.Error("Expected a single writer to be matched on Writer")
+	}
+
+	fanOut := New(WithWriter("console"), WithOutputs([]OutputConfig{{Writer: "console"}, {Writer: "csv"}}), WithOutputErrors(OutputErrorsFail))
+	if !fanOut.HasWriter(CSVExporterKind) || fanOut.HasWriter(FileWriterKind) {
+		t.Error("Expected every output of a fan-out to be matched")
+	}
+	if fanOut.OutputErrors != OutputErrorsFail {
+		t.Errorf("Expected OutputErrors to be set, got %s", fanOut.OutputErrors)
+	}
+}
+
+func TestWithProtoOptions(t *testing.T) {
+	mappings := []ProtoMapping{{RoutingKey: "^orders\\.", Type: "com.acme.OrderCreated"}}
+	config := New(
+		WithProtoDescriptors([]string{"set.pb"}),
+		WithProtoType("com.acme.OrderCreated"),
+		WithProtoMappings(mappings),
+	)
+
+	if len(config.ProtoDescriptors) != 1 || config.ProtoDescriptors[0] != "set.pb" {
+		t.Errorf("Expected ProtoDescriptors to be set, got %v", config.ProtoDescriptors)
+	}
+
+	if config.ProtoType != "com.acme.OrderCreated" {
+		t.Errorf("Expected ProtoType to be set, got %s", config.ProtoType)
+	}
+
+	if len(config.ProtoMappings) != 1 || config.ProtoMappings[0].Type != "com.acme.OrderCreated" {
+		t.Errorf("Expected ProtoMappings to be set, got %v", config.ProtoMappings)
+	}
+}
+
+func TestWithCodecOptions(t *testing.T) {
+	config := New(WithCodec("avro"), WithAvroSchemas([]string{"order.avsc"}))
+
+	if config.Codec != "avro" {
+		t.Errorf("Expected Codec avro, got %s", config.Codec)
+	}
+
+	if len(config.AvroSchemas) != 1 || config.AvroSchemas[0] != "order.avsc" {
+		t.Errorf("Expected AvroSchemas to be set, got %v", config.AvroSchemas)
+	}
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultVirtualHost is the virtual host RabbitMQ creates on install
+const DefaultVirtualHost = "/"
+
+// Config keys of the credentials flags. They are not named after the flags
+// so the USER environment variable is not taken as the RabbitMQ user.
+const (
+	UserKey         = "rabbitmq-user"
+	PasswordKey     = "rabbitmq-password"
+	PasswordFileKey = "rabbitmq-password-file"
+)
+
+// URIOptions are the parts an AMQP URI is built from. URI is a full
+// amqp[s]:// URI, the other options override its parts when set.
+type URIOptions struct {
+	URI          string
+	Host         string // host[:port], optionally with user:password@
+	VirtualHost  string
+	User         string
+	Password     string
+	PasswordFile string
+	Secure       bool
+}
+
+// BuildURI builds the AMQP URI to connect with, percent-encoding the
+// credentials and the virtual host: the default virtual host "/" becomes
+// amqp://localhost:5672/%2F
+func BuildURI(opts URIOptions) (string, error) {
+	u := &url.URL{Scheme: "amqp"}
+	vhost := DefaultVirtualHost
+
+	if opts.URI != "" {
+		base, err := url.Parse(opts.URI)
+		if err != nil {
+			return "", fmt.Errorf("invalid URI: %v", redactError(err))
+		}
+		if base.Scheme != "amqp" && base.Scheme != "amqps" {
+			return "", fmt.Errorf("URI scheme must be amqp or amqps, got %q", base.Scheme)
+		}
+		if base.Host == "" {
+			return "", fmt.Errorf("URI has no host")
+		}
+		u.Scheme, u.Host, u.User, u.RawQuery = base.Scheme, base.Host, base.User, base.RawQuery
+		if len(base.Path) > 1 {
+			vhost = base.Path[1:]
+		}
+	}
+
+	if opts.Host != "" {
+		if strings.Contains(opts.Host, "://") {
+			return "", fmt.Errorf("host %q is a URI, use --uri instead", RedactURI(opts.Host))
+		}
+		host, err := url.Parse("//" + opts.Host)
+		if err != nil {
+			return "", fmt.Errorf("invalid host: %v", redactError(err))
+		}
+		if host.Host == "" || host.Path != "" || host.RawQuery != "" {
+			return "", fmt.Errorf("invalid host %q, expected host[:port]", host.Redacted()[2:])
+		}
+		u.Host = host.Host
+		if host.User != nil {
+			u.User = host.User
+		}
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("RabbitMQ host is required")
+	}
+
+	if opts.Secure {
+		u.Scheme = "amqps"
+	}
+	if opts.VirtualHost != "" {
+		vhost = opts.VirtualHost
+	}
+
+	user, err := userInfo(u.User, opts)
+	if err != nil {
+		return "", err
+	}
+	u.User = user
+
+	u.Path = "/" + vhost
+	u.RawPath = "/" + url.PathEscape(vhost)
+
+	return u.String(), nil
+}
+
+// userInfo applies --user, --password and --password-file to the
+// credentials of the URI
+func userInfo(current *url.Userinfo, opts URIOptions) (*url.Userinfo, error) {
+	var user, password string
+	var hasPassword bool
+	if current != nil {
+		user = current.Username()
+		password, hasPassword = current.Password()
+	}
+
+	if opts.User != "" {
+		user = opts.User
+	}
+
+	switch {
+	case opts.Password != "" && opts.PasswordFile != "":
+		return nil, fmt.Errorf("use either --password or --password-file, not both")
+	case opts.Password != "":
+		password, hasPassword = opts.Password, true
+	case opts.PasswordFile != "":
+		content, err := os.ReadFile(opts.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password file: %v", err)
+		}
+		password, hasPassword = strings.TrimRight(string(content), "\r\n"), true
+	}
+
+	switch {
+	case user == "" && hasPassword:
+		return nil, fmt.Errorf("a password needs a user, set --user")
+	case user == "":
+		return nil, nil
+	case hasPassword:
+		return url.UserPassword(user, password), nil
+	default:
+		return url.User(user), nil
+	}
+}
+
+// URIFromFlags builds the URI from the connection flags and the config
+// file. --uri replaces --url, --virtualhost and --secure, the credentials
+// flags override its user and password.
+func URIFromFlags() (string, error) {
+	opts := URIOptions{
+		URI:          viper.GetString("uri"),
+		User:         viper.GetString(UserKey),
+		Password:     viper.GetString(PasswordKey),
+		PasswordFile: viper.GetString(PasswordFileKey),
+	}
+	if opts.URI == "" {
+		opts.Host = viper.GetString("url")
+		opts.VirtualHost = viper.GetString("virtualhost")
+		opts.Secure = viper.GetBool("secure")
+	}
+	return BuildURI(opts)
+}
+
+// RedactURI hides the password of a URI, so it can be printed and logged
+func RedactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "<invalid URI>"
+	}
+	return u.Redacted()
+}
+
+// redactError drops the input of URL parse errors, which holds the password
+func redactError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+	return err
+}
@@ -1,12 +1,16 @@
 package app
 
-import "github.com/marianozunino/goq/internal/config"
+import (
+	"context"
+
+	"github.com/marianozunino/goq/internal/config"
+)
 
 // Dump is a package-level function for convenience
-func Dump(cfg *config.Config) error {
+func Dump(ctx context.Context, cfg *config.Config) error {
 	processor, err := NewMessageProcessor(cfg)
 	if err != nil {
 		return err
 	}
-	return processor.Dump()
+	return processor.Dump(ctx)
 }
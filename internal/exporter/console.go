@@ -3,25 +3,36 @@ package exporter
 import (
 	"fmt"
 	"os"
+	"text/template"
 
 	"github.com/marianozunino/goq/internal/config"
+	"github.com/marianozunino/goq/internal/filter"
 	"github.com/wagslane/go-rabbitmq"
 )
 
 type ConsoleExporter struct {
-	config *config.Config
+	config    *config.Config
+	transform *filter.MessageFilter
+	template  *template.Template
 }
 
 var _ Exporter = &ConsoleExporter{}
 
 func NewConsoleExporter(cfg *config.Config) (*ConsoleExporter, error) {
+	tmpl, err := newTemplate(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+
 	return &ConsoleExporter{
-		config: cfg,
+		config:    cfg,
+		transform: filter.NewMessageFilter(cfg),
+		template:  tmpl,
 	}, nil
 }
 
 func (w *ConsoleExporter) WriteMessage(msg rabbitmq.Delivery) error {
-	output, err := writeMessageCommon(msg, w.config.PrettyPrint)
+	output, err := writeMessageCommon(msg, w.config, w.transform, w.template)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,262 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/marianozunino/goq/internal/filter"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+// defaultColumns are used when --columns is not given
+const defaultColumns = "exchange=.exchange,routingKey=.routingKey,body=.body"
+
+func init() {
+	RegisterExporterFactory(string(config.CSVExporterKind), &CSVExporterFactory{Comma: ','})
+	RegisterExporterFactory(string(config.TSVExporterKind), &CSVExporterFactory{Comma: '\t'})
+}
+
+// CSVExporterFactory creates delimited text exporters, CSV or TSV depending
+// on the field separator
+type CSVExporterFactory struct {
+	Comma rune
+}
+
+func (f *CSVExporterFactory) GetType() string {
+	if f.Comma == '\t' {
+		return string(config.TSVExporterKind)
+	}
+	return string(config.CSVExporterKind)
+}
+
+func (f *CSVExporterFactory) CreateExporter(cfg *config.Config) (Exporter, error) {
+	return NewCSVExporter(cfg, f.Comma)
+}
+
+// column is a named jq path evaluated against every exported record
+type column struct {
+	name  string
+	query *gojq.Query
+}
+
+// CSVExporter writes one row per exported record, with a header row naming
+// the columns. Output goes to the output file when one is given, otherwise
+// to stdout.
+type CSVExporter struct {
+	writer    *csv.Writer
+	file      *os.File
+	columns   []column
+	config    *config.Config
+	transform *filter.MessageFilter
+}
+
+var _ Exporter = &CSVExporter{}
+
+func NewCSVExporter(cfg *config.Config, comma rune) (*CSVExporter, error) {
+	spec := cfg.Columns
+	if strings.TrimSpace(spec) == "" {
+		spec = defaultColumns
+	}
+	columns, err := parseColumns(spec)
+	if err != nil {
+		return nil, &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  err,
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	var file *os.File
+	writeHeader := true
+
+	if cfg.OutputFile != "" {
+		file, err = openOutput(expandOutputName(cfg.OutputFile, time.Now()), cfg.FileMode)
+		if err != nil {
+			return nil, err
+		}
+
+		// Appending to an existing export must not repeat the header
+		if info, err := file.Stat(); err == nil && info.Size() > 0 {
+			writeHeader = false
+		}
+		out = file
+	}
+
+	w := &CSVExporter{
+		writer:    csv.NewWriter(out),
+		file:      file,
+		columns:   columns,
+		config:    cfg,
+		transform: filter.NewMessageFilter(cfg),
+	}
+	w.writer.Comma = comma
+
+	if writeHeader {
+		header := make([]string, len(columns))
+		for i, c := range columns {
+			header[i] = c.name
+		}
+		if err := w.writeRow(header); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+func (w *CSVExporter) WriteMessage(msg rabbitmq.Delivery) error {
+	records, err := exportRecords(msg, w.config, w.transform)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		row := make([]string, len(w.columns))
+		for i, c := range w.columns {
+			cell, err := evaluateColumn(c, record)
+			if err != nil {
+				return &ExporterError{
+					Type: ErrorTypeTransform,
+					Err:  err,
+				}
+			}
+			row[i] = cell
+		}
+		if err := w.writeRow(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *CSVExporter) writeRow(row []string) error {
+	if err := w.writer.Write(row); err != nil {
+		return w.ioError(fmt.Errorf("failed to write row: %v", err))
+	}
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return w.ioError(fmt.Errorf("failed to flush buffer: %v", err))
+	}
+	return nil
+}
+
+func (w *CSVExporter) ioError(err error) error {
+	errType := ErrorTypeFileIO
+	if w.file == nil {
+		errType = ErrorTypeConsoleIO
+	}
+	return &ExporterError{Type: errType, Err: err}
+}
+
+func (w *CSVExporter) Close() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return w.ioError(fmt.Errorf("failed to flush buffer on close: %v", err))
+	}
+	if w.file == nil {
+		return nil
+	}
+	if err := w.file.Close(); err != nil {
+		return &ExporterError{
+			Type: ErrorTypeFileIO,
+			Err:  fmt.Errorf("failed to close file: %v", err),
+		}
+	}
+	return nil
+}
+
+// evaluateColumn returns the cell of a column: strings as is, null as an
+// empty cell and anything else as compact JSON. Only the first value emitted
+// by the expression is used.
+func evaluateColumn(c column, record interface{}) (string, error) {
+	iter := c.query.Run(record)
+	v, ok := iter.Next()
+	if !ok {
+		return "", nil
+	}
+	if err, isErr := v.(error); isErr {
+		return "", fmt.Errorf("column %s: %v", c.name, err)
+	}
+
+	switch val := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	default:
+		encoded, err := json.Marshal(val)
+		if err != nil {
+			return "", fmt.Errorf("column %s: %v", c.name, err)
+		}
+		return string(encoded), nil
+	}
+}
+
+// parseColumns parses a comma separated list of name=jq-path definitions. A
+// definition without a name is named after its path. Commas inside brackets,
+// parentheses, braces or strings belong to the jq expression.
+func parseColumns(spec string) ([]column, error) {
+	var columns []column
+	for _, def := range splitColumns(spec) {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+
+		name, path := def, def
+		if i := strings.Index(def, "="); i > 0 && !strings.ContainsAny(def[:i], ".[\"|(") {
+			name, path = strings.TrimSpace(def[:i]), strings.TrimSpace(def[i+1:])
+		}
+
+		query, err := gojq.Parse(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid column %s: %v", name, err)
+		}
+		columns = append(columns, column{name: name, query: query})
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns defined")
+	}
+	return columns, nil
+}
+
+// splitColumns splits spec on the commas that are not nested in a jq
+// expression
+func splitColumns(spec string) []string {
+	var parts []string
+	depth := 0
+	inString := false
+	start := 0
+
+	for i := 0; i < len(spec); i++ {
+		switch ch := spec[i]; {
+		case inString:
+			if ch == '\\' {
+				i++
+			} else if ch == '"' {
+				inString = false
+			}
+		case ch == '"':
+			inString = true
+		case ch == '[' || ch == '(' || ch == '{':
+			depth++
+		case ch == ']' || ch == ')' || ch == '}':
+			depth--
+		case ch == ',' && depth == 0:
+			parts = append(parts, spec[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, spec[start:])
+}
@@ -0,0 +1,181 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+func readRows(t *testing.T, path string, comma rune) [][]string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open output: %v", err)
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.Comma = comma
+	rows, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	return rows
+}
+
+func TestParseColumns(t *testing.T) {
+	columns, err := parseColumns(`id=.body.id,tenant=.headers["x-tenant"],rk=.routingKey, .body.items | map(.sku, .qty)`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, c := range columns {
+		names = append(names, c.name)
+	}
+	expected := []string{"id", "tenant", "rk", ".body.items | map(.sku, .qty)"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected columns %v, got %v", expected, names)
+	}
+
+	for _, spec := range []string{"", " , ", "id=.body[", "id=.body |"} {
+		if _, err := parseColumns(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestCSVExporter_WriteMessage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv")
+	cfg := &config.Config{
+		Writer:     config.CSVExporterKind,
+		OutputFile: path,
+		Columns:    `id=.body.id,tenant=.headers["x-tenant"],rk=.routingKey,note=.body.note,tags=.body.tags,missing=.body.nope`,
+	}
+
+	exporter, err := NewExporter(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	if _, ok := exporter.(*CSVExporter); !ok {
+		t.Fatalf("Expected a CSV exporter for the csv writer, got %T", exporter)
+	}
+
+	var msg rabbitmq.Delivery
+	msg.Body = []byte(`{"id": 7, "note": "line one\nline two, with comma and \"quotes\"", "tags": ["a", "b"]}`)
+	msg.RoutingKey = "orders.created"
+	msg.Headers = amqp091.Table{"x-tenant": "acme"}
+
+	if err := exporter.WriteMessage(msg); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("Failed to close exporter: %v", err)
+	}
+
+	rows := readRows(t, path, ',')
+	expected := [][]string{
+		{"id", "tenant", "rk", "note", "tags", "missing"},
+		{"7", "acme", "orders.created", "line one\nline two, with comma and \"quotes\"", `["a","b"]`, ""},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected rows %q, got %q", expected, rows)
+	}
+}
+
+func TestCSVExporter_TSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.tsv")
+	cfg := &config.Config{
+		Writer:     config.TSVExporterKind,
+		OutputFile: path,
+		Columns:    "rk=.routingKey,body=.body",
+	}
+
+	exporter, err := NewExporter(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+
+	var msg rabbitmq.Delivery
+	msg.Body = []byte("tab\tseparated")
+	msg.RoutingKey = "plain"
+	if err := exporter.WriteMessage(msg); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	exporter.Close()
+
+	content, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(content), "rk\tbody\n") {
+		t.Errorf("Expected tab separated header, got %q", content)
+	}
+
+	rows := readRows(t, path, '\t')
+	if len(rows) != 2 || rows[1][1] != "tab\tseparated" {
+		t.Errorf("Expected quoted tab in body, got %q", rows)
+	}
+}
+
+func TestCSVExporter_AppendSkipsHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv")
+	cfg := &config.Config{
+		OutputFile: path,
+		FileMode:   "append",
+		Columns:    "rk=.routingKey",
+	}
+
+	for _, key := range []string{"first", "second"} {
+		exporter, err := NewCSVExporter(cfg, ',')
+		if err != nil {
+			t.Fatalf("Failed to create exporter: %v", err)
+		}
+		var msg rabbitmq.Delivery
+		msg.RoutingKey = key
+		if err := exporter.WriteMessage(msg); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+		exporter.Close()
+	}
+
+	rows := readRows(t, path, ',')
+	expected := [][]string{{"rk"}, {"first"}, {"second"}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected rows %q, got %q", expected, rows)
+	}
+}
+
+func TestCSVExporter_Transform(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv")
+	cfg := &config.Config{
+		OutputFile: path,
+		Columns:    "sku=.sku",
+		FilterConfig: config.FilterConfig{
+			MaxMessageSize: -1,
+			Transform:      ".body.items[]",
+		},
+	}
+
+	exporter, err := NewCSVExporter(cfg, ',')
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+
+	var msg rabbitmq.Delivery
+	msg.Body = []byte(`{"items": [{"sku": "a"}, {"sku": "b"}]}`)
+	if err := exporter.WriteMessage(msg); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	exporter.Close()
+
+	rows := readRows(t, path, ',')
+	expected := [][]string{{"sku"}, {"a"}, {"b"}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected one row per transformed record %q, got %q", expected, rows)
+	}
+}
@@ -3,8 +3,10 @@ package exporter
 import (
 	"encoding/json"
 	"fmt"
+	"text/template"
 
 	"github.com/marianozunino/goq/internal/config"
+	"github.com/marianozunino/goq/internal/filter"
 	"github.com/marianozunino/goq/internal/model"
 	"github.com/wagslane/go-rabbitmq"
 )
@@ -29,6 +31,8 @@ const (
 	ErrorTypeFileIO        = "file_io"
 	ErrorTypeConsoleIO     = "console_io"
 	ErrorTypeConfiguration = "configuration"
+	ErrorTypeTransform     = "transform"
+	ErrorTypeDatabase      = "database"
 )
 
 type Exporter interface {
@@ -73,9 +77,22 @@ func RegisterExporterFactory(name string, factory ExporterFactory) {
 	exporterFactories[name] = factory
 }
 
-// NewExporter creates an exporter using the default factory
+// NewExporter creates an exporter using the factory registered for the
+// writer kind, falling back to the default factory. Several outputs are
+// combined into a MultiExporter, and with --split-by the file writer is
+// wrapped to write one file per key.
 func NewExporter(cfg *config.Config) (Exporter, error) {
-	factory := exporterFactories["default"]
+	if len(cfg.Outputs) > 0 {
+		return NewMultiExporter(cfg)
+	}
+	if cfg.SplitBy != "" {
+		return NewSplitExporter(cfg)
+	}
+
+	factory, ok := exporterFactories[string(cfg.Writer)]
+	if !ok {
+		factory = exporterFactories["default"]
+	}
 	return factory.CreateExporter(cfg)
 }
 
@@ -92,8 +109,9 @@ func convertHeaders(amqpHeaders rabbitmq.Table) map[string]interface{} {
 	return headers
 }
 
-// writeMessageCommon handles the message creation and serialization
-func writeMessageCommon(msg rabbitmq.Delivery, prettyPrint bool) ([]byte, error) {
+// newMessage builds the exported representation of a delivery, including
+// the AMQP properties when fullMessage is set
+func newMessage(msg rabbitmq.Delivery, fullMessage bool) model.Message {
 	message := model.Message{
 		Headers:    convertHeaders(rabbitmq.Table(msg.Headers)),
 		Exchange:   msg.Exchange,
@@ -101,12 +119,120 @@ func writeMessageCommon(msg rabbitmq.Delivery, prettyPrint bool) ([]byte, error)
 		Body:       msg.Body,
 	}
 
+	if !msg.Timestamp.IsZero() {
+		message.Timestamp = msg.Timestamp.Unix()
+	}
+
+	if fullMessage {
+		message.Properties = &model.Properties{
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			DeliveryMode:    msg.DeliveryMode,
+			Priority:        msg.Priority,
+			CorrelationID:   msg.CorrelationId,
+			ReplyTo:         msg.ReplyTo,
+			Expiration:      msg.Expiration,
+			MessageID:       msg.MessageId,
+			Type:            msg.Type,
+			UserID:          msg.UserId,
+			AppID:           msg.AppId,
+			DeliveryTag:     msg.DeliveryTag,
+			Redelivered:     msg.Redelivered,
+			ConsumerTag:     msg.ConsumerTag,
+		}
+	}
+
+	return message
+}
+
+// writeMessageCommon handles the message creation and serialization. When a
+// transform is configured its results replace the exported record, one line
+// (or pretty printed block) per emitted value. With an output template the
+// message is rendered through it instead of being serialized as JSON, once
+// per transform result when there is a transform.
+func writeMessageCommon(msg rabbitmq.Delivery, cfg *config.Config, transform *filter.MessageFilter, tmpl *template.Template) ([]byte, error) {
+	if transform == nil || !transform.HasTransform() {
+		if tmpl != nil {
+			return renderTemplate(tmpl, newTemplateMessage(msg))
+		}
+		message := newMessage(msg, cfg.FullMessage)
+		return marshalRecord(&message, cfg.PrettyPrint)
+	}
+
+	records, err := exportRecords(msg, cfg, transform)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope *TemplateMessage
+	if tmpl != nil {
+		envelope = newTemplateMessage(msg)
+	}
+
+	var output []byte
+	for _, record := range records {
+		var line []byte
+		if tmpl != nil {
+			view := *envelope
+			view.Transformed = record
+			line, err = renderTemplate(tmpl, &view)
+		} else {
+			line, err = marshalRecord(record, cfg.PrettyPrint)
+		}
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, line...)
+	}
+
+	return output, nil
+}
+
+// exportRecords returns the exported records of a delivery as generic JSON
+// values: the message itself, or the results of the transform when one is
+// configured
+func exportRecords(msg rabbitmq.Delivery, cfg *config.Config, transform *filter.MessageFilter) ([]interface{}, error) {
+	message := newMessage(msg, cfg.FullMessage)
+
+	// Round-trip through JSON so jq sees the same document that would have
+	// been exported
+	encoded, err := json.Marshal(&message)
+	if err != nil {
+		return nil, &ExporterError{
+			Type: ErrorTypeSerialization,
+			Err:  fmt.Errorf("failed to marshal message: %v", err),
+		}
+	}
+	var record interface{}
+	if err := json.Unmarshal(encoded, &record); err != nil {
+		return nil, &ExporterError{
+			Type: ErrorTypeSerialization,
+			Err:  fmt.Errorf("failed to decode message: %v", err),
+		}
+	}
+
+	if transform == nil || !transform.HasTransform() {
+		return []interface{}{record}, nil
+	}
+
+	results, err := transform.Transform(record)
+	if err != nil {
+		return nil, &ExporterError{
+			Type: ErrorTypeTransform,
+			Err:  err,
+		}
+	}
+	return results, nil
+}
+
+// marshalRecord serializes a single exported record followed by a newline
+func marshalRecord(record interface{}, prettyPrint bool) ([]byte, error) {
 	var output []byte
 	var err error
 	if prettyPrint {
-		output, err = json.MarshalIndent(message, "", "  ")
+		output, err = json.MarshalIndent(record, "", "  ")
 	} else {
-		output, err = json.Marshal(message)
+		output, err = json.Marshal(record)
 	}
 
 	if err != nil {
@@ -1,10 +1,15 @@
 package exporter
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/marianozunino/goq/internal/config"
+	"github.com/marianozunino/goq/internal/filter"
+	"github.com/wagslane/go-rabbitmq"
 )
 
 func TestExporterError_Error(t *testing.T) {
@@ -131,3 +136,128 @@ func contains(s, substr string) bool {
 				s[len(s)-len(substr):] == substr ||
 				contains(s[1:], substr))))
 }
+
+func TestNewMessage_FullMessage(t *testing.T) {
+	var msg rabbitmq.Delivery
+	msg.Body = []byte(`{"test": "data"}`)
+	msg.Exchange = "test_exchange"
+	msg.RoutingKey = "test.key"
+	msg.ContentType = "application/json"
+	msg.CorrelationId = "corr-1"
+	msg.MessageId = "msg-1"
+	msg.DeliveryTag = 7
+	msg.Redelivered = true
+	msg.Timestamp = time.Unix(1700000000, 0)
+
+	message := newMessage(msg, true)
+
+	if message.Timestamp != 1700000000 {
+		t.Errorf("Expected timestamp 1700000000, got %d", message.Timestamp)
+	}
+
+	if message.Properties == nil {
+		t.Fatal("Expected properties in full message mode")
+	}
+
+	if message.Properties.ContentType != "application/json" {
+		t.Errorf("Expected content type 'application/json', got %s", message.Properties.ContentType)
+	}
+
+	if message.Properties.CorrelationID != "corr-1" {
+		t.Errorf("Expected correlation ID 'corr-1', got %s", message.Properties.CorrelationID)
+	}
+
+	if message.Properties.MessageID != "msg-1" {
+		t.Errorf("Expected message ID 'msg-1', got %s", message.Properties.MessageID)
+	}
+
+	if message.Properties.DeliveryTag != 7 || !message.Properties.Redelivered {
+		t.Error("Expected delivery tag and redelivered flag to be set")
+	}
+
+	if newMessage(msg, false).Properties != nil {
+		t.Error("Expected no properties when full message mode is disabled")
+	}
+}
+
+func TestWriteMessageCommon_StringBody(t *testing.T) {
+	var msg rabbitmq.Delivery
+	msg.Body = []byte("plain text")
+
+	output, err := writeMessageCommon(msg, &config.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error writing plain text body: %v", err)
+	}
+
+	if !strings.Contains(string(output), `"body":"plain text"`) {
+		t.Errorf("Expected plain text body in output, got %s", output)
+	}
+}
+
+func TestWriteMessageCommon_Transform(t *testing.T) {
+	var msg rabbitmq.Delivery
+	msg.RoutingKey = "orders.created"
+	msg.Body = []byte(`{"id": 1, "items": [{"sku": "a"}, {"sku": "b"}]}`)
+
+	cfg := &config.Config{}
+	cfg.FilterConfig.Transform = `.routingKey as $rk | .body.items[] | {rk: $rk, sku}`
+
+	output, err := writeMessageCommon(msg, cfg, filter.NewMessageFilter(cfg), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error transforming message: %v", err)
+	}
+
+	expected := "{\"rk\":\"orders.created\",\"sku\":\"a\"}\n{\"rk\":\"orders.created\",\"sku\":\"b\"}\n"
+	if string(output) != expected {
+		t.Errorf("Expected one record per emitted value, got %q", output)
+	}
+}
+
+func TestWriteMessageCommon_TransformEmpty(t *testing.T) {
+	var msg rabbitmq.Delivery
+	msg.Body = []byte(`{"id": 1}`)
+
+	cfg := &config.Config{}
+	cfg.FilterConfig.Transform = `empty`
+
+	output, err := writeMessageCommon(msg, cfg, filter.NewMessageFilter(cfg), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error transforming message: %v", err)
+	}
+
+	if len(output) != 0 {
+		t.Errorf("Expected no output, got %q", output)
+	}
+}
+
+func TestWriteMessageCommon_TransformError(t *testing.T) {
+	var msg rabbitmq.Delivery
+	msg.Body = []byte(`{"id": "not a number"}`)
+
+	cfg := &config.Config{}
+	cfg.FilterConfig.Transform = `.body.id + 1`
+
+	_, err := writeMessageCommon(msg, cfg, filter.NewMessageFilter(cfg), nil)
+	if err == nil {
+		t.Fatal("Expected runtime transform error")
+	}
+
+	var exporterErr *ExporterError
+	if !errors.As(err, &exporterErr) || exporterErr.Type != ErrorTypeTransform {
+		t.Errorf("Expected transform ExporterError, got %v", err)
+	}
+}
+
+func TestWriteMessageCommon_BinaryBody(t *testing.T) {
+	var msg rabbitmq.Delivery
+	msg.Body = []byte{0x1f, 0x8b, 0x08, 0x00, 0xff}
+
+	output, err := writeMessageCommon(msg, &config.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error writing binary body: %v", err)
+	}
+
+	if !strings.Contains(string(output), `"bodyEncoding":"base64","body":"H4sIAP8="`) {
+		t.Errorf("Expected base64 encoded body in output, got %s", output)
+	}
+}
@@ -4,57 +4,69 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"text/template"
+	"time"
 
 	"github.com/marianozunino/goq/internal/config"
+	"github.com/marianozunino/goq/internal/filter"
 	"github.com/wagslane/go-rabbitmq"
 )
 
 type FileExporter struct {
-	writer *bufio.Writer
-	file   *os.File
-	config *config.Config
+	writer    *bufio.Writer
+	file      *os.File
+	config    *config.Config
+	transform *filter.MessageFilter
+	template  *template.Template
+	rotation  *rotation
 }
 
 var _ Exporter = &FileExporter{}
 
 func NewFileWriter(cfg *config.Config) (*FileExporter, error) {
-	var file *os.File
-	var err error
-
-	// Open file based on config
-	switch cfg.FileMode {
-	case "append":
-		file, err = os.OpenFile(cfg.OutputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
-	case "overwrite", "":
-		file, err = os.Create(cfg.OutputFile)
-	default:
-		return nil, &ExporterError{
-			Type: ErrorTypeConfiguration,
-			Err:  fmt.Errorf("invalid file mode: %s (use 'append' or 'overwrite')", cfg.FileMode),
-		}
+	rot, err := newRotation(cfg)
+	if err != nil {
+		return nil, err
 	}
+
+	tmpl, err := newTemplate(cfg, false)
 	if err != nil {
-		return nil, &ExporterError{
-			Type: ErrorTypeFileIO,
-			Err:  fmt.Errorf("failed to open/create output file: %v", err),
-		}
+		return nil, err
+	}
+
+	file, err := openOutput(expandOutputName(cfg.OutputFile, time.Now()), cfg.FileMode)
+	if err != nil {
+		return nil, err
 	}
 
 	writer := bufio.NewWriter(file)
 
+	if rot != nil {
+		rot.start(file)
+	}
+
 	return &FileExporter{
-		writer: writer,
-		file:   file,
-		config: cfg,
+		writer:    writer,
+		file:      file,
+		config:    cfg,
+		transform: filter.NewMessageFilter(cfg),
+		template:  tmpl,
+		rotation:  rot,
 	}, nil
 }
 
 func (w *FileExporter) WriteMessage(msg rabbitmq.Delivery) error {
-	output, err := writeMessageCommon(msg, w.config.PrettyPrint)
+	output, err := writeMessageCommon(msg, w.config, w.transform, w.template)
 	if err != nil {
 		return err
 	}
 
+	if w.rotation != nil && w.rotation.due(len(output)) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
 	_, err = w.writer.Write(output)
 	if err != nil {
 		return &ExporterError{
@@ -70,6 +82,28 @@ func (w *FileExporter) WriteMessage(msg rabbitmq.Delivery) error {
 		}
 	}
 
+	if w.rotation != nil {
+		w.rotation.size += int64(len(output))
+	}
+
+	return nil
+}
+
+// rotate moves writing to a new segment
+func (w *FileExporter) rotate() error {
+	if err := w.writer.Flush(); err != nil {
+		return &ExporterError{
+			Type: ErrorTypeFileIO,
+			Err:  fmt.Errorf("failed to flush buffer: %v", err),
+		}
+	}
+
+	file, err := w.rotation.rotate(w.file)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.writer.Reset(file)
 	return nil
 }
 
@@ -86,5 +120,8 @@ func (w *FileExporter) Close() error {
 			Err:  fmt.Errorf("failed to close file: %v", err),
 		}
 	}
+	if w.rotation != nil {
+		w.rotation.close()
+	}
 	return nil
 }
@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+// ErrOutputFailed marks the write errors of a fan-out configured to fail
+// fast, processing should stop when it is returned
+var ErrOutputFailed = errors.New("output failed")
+
+// MultiExporter writes every message to several exporters. By default a
+// failing output does not keep the message from the others, and the errors
+// are returned together; with --on-output-error fail the first error is
+// returned right away, wrapped in ErrOutputFailed.
+type MultiExporter struct {
+	outputs  []output
+	failFast bool
+}
+
+// output is one named sink of a MultiExporter
+type output struct {
+	name     string
+	exporter Exporter
+}
+
+var _ Exporter = &MultiExporter{}
+
+func NewMultiExporter(cfg *config.Config) (*MultiExporter, error) {
+	w := &MultiExporter{}
+
+	switch cfg.OutputErrors {
+	case config.OutputErrorsContinue, "":
+	case config.OutputErrorsFail:
+		w.failFast = true
+	default:
+		return nil, &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  fmt.Errorf("invalid output error mode: %s (use %s or %s)", cfg.OutputErrors, config.OutputErrorsContinue, config.OutputErrorsFail),
+		}
+	}
+
+	files := map[string]string{}
+	for i, out := range cfg.Outputs {
+		outputCfg := outputConfig(cfg, out)
+		name := fmt.Sprintf("output %d (%s)", i+1, out.Writer)
+
+		if outputCfg.Writer != config.ConsoleExporterKind && outputCfg.OutputFile != "" {
+			path := filepath.Clean(outputCfg.OutputFile)
+			if other, ok := files[path]; ok {
+				w.Close()
+				return nil, &ExporterError{
+					Type: ErrorTypeConfiguration,
+					Err:  fmt.Errorf("%s and %s both write to %s", other, name, outputCfg.OutputFile),
+				}
+			}
+			files[path] = name
+		}
+
+		exporter, err := NewExporter(outputCfg)
+		if err != nil {
+			w.Close()
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		w.outputs = append(w.outputs, output{name: name, exporter: exporter})
+	}
+
+	return w, nil
+}
+
+func (w *MultiExporter) WriteMessage(msg rabbitmq.Delivery) error {
+	var errs []error
+	for _, out := range w.outputs {
+		if err := out.exporter.WriteMessage(msg); err != nil {
+			if w.failFast {
+				return fmt.Errorf("%w: %s: %w", ErrOutputFailed, out.name, err)
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", out.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every output, even when some fail to
+func (w *MultiExporter) Close() error {
+	var errs []error
+	for _, out := range w.outputs {
+		if err := out.exporter.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", out.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// outputConfig returns the configuration of one output: the command line
+// configuration with the options set for the output
+func outputConfig(cfg *config.Config, out config.OutputConfig) *config.Config {
+	c := *cfg
+	c.Outputs = nil
+	c.Writer = config.ExporterKind(out.Writer)
+
+	if out.Output != "" {
+		c.OutputFile = out.Output
+	}
+	if out.FileMode != "" {
+		c.FileMode = out.FileMode
+	}
+	if out.PrettyPrint != nil {
+		c.PrettyPrint = *out.PrettyPrint
+	}
+	if out.FullMessage != nil {
+		c.FullMessage = *out.FullMessage
+	}
+	if out.Columns != "" {
+		c.Columns = out.Columns
+	}
+	if out.Transform != "" {
+		c.FilterConfig.Transform = out.Transform
+	}
+	if out.Format != "" || out.TemplateFile != "" {
+		c.Format = out.Format
+		c.TemplateFile = out.TemplateFile
+	}
+
+	// Only files are split, the other outputs get every message
+	if c.Writer != config.FileWriterKind {
+		c.SplitBy = ""
+	}
+
+	return &c
+}
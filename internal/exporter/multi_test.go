@@ -0,0 +1,157 @@
+package exporter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+// failingExporter rejects every message
+type failingExporter struct {
+	writes int
+}
+
+func (f *failingExporter) WriteMessage(msg rabbitmq.Delivery) error {
+	f.writes++
+	return &ExporterError{Type: ErrorTypeFileIO, Err: errors.New("disk full")}
+}
+
+func (f *failingExporter) Close() error { return nil }
+
+// countingExporter accepts every message
+type countingExporter struct {
+	writes int
+	closed bool
+}
+
+func (c *countingExporter) WriteMessage(msg rabbitmq.Delivery) error {
+	c.writes++
+	return nil
+}
+
+func (c *countingExporter) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestMultiExporter_Outputs(t *testing.T) {
+	dir := t.TempDir()
+	pretty := true
+	cfg := &config.Config{
+		Writer:     config.FileWriterKind,
+		OutputFile: filepath.Join(dir, "dump.json"),
+		Outputs: []config.OutputConfig{
+			{Writer: "file", PrettyPrint: &pretty},
+			{Writer: "csv", Output: filepath.Join(dir, "dump.csv"), Columns: "rk=.routingKey"},
+		},
+	}
+
+	exporter, err := NewExporter(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	if _, ok := exporter.(*MultiExporter); !ok {
+		t.Fatalf("Expected a fan-out for several outputs, got %T", exporter)
+	}
+
+	if err := exporter.WriteMessage(delivery("", "orders.created", nil, `{"id": 1}`)); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("Failed to close exporter: %v", err)
+	}
+
+	jsonOutput, _ := os.ReadFile(filepath.Join(dir, "dump.json"))
+	if !strings.Contains(string(jsonOutput), "\n  \"routingKey\": \"orders.created\"") {
+		t.Errorf("Expected the file output to be pretty printed, got %s", jsonOutput)
+	}
+
+	csvOutput, _ := os.ReadFile(filepath.Join(dir, "dump.csv"))
+	if string(csvOutput) != "rk\norders.created\n" {
+		t.Errorf("Expected the csv output with its own columns, got %q", csvOutput)
+	}
+}
+
+func TestMultiExporter_ErrorModes(t *testing.T) {
+	msg := delivery("", "key", nil, "{}")
+
+	t.Run("continue", func(t *testing.T) {
+		failing, counting := &failingExporter{}, &countingExporter{}
+		exporter := &MultiExporter{outputs: []output{{"output 1 (file)", failing}, {"output 2 (console)", counting}}}
+
+		err := exporter.WriteMessage(msg)
+		if err == nil || !strings.Contains(err.Error(), "output 1 (file)") {
+			t.Errorf("Expected the failing output to be reported, got %v", err)
+		}
+		if errors.Is(err, ErrOutputFailed) {
+			t.Error("Expected processing to go on in continue mode")
+		}
+		if counting.writes != 1 {
+			t.Error("Expected the other outputs to still get the message")
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		failing, counting := &failingExporter{}, &countingExporter{}
+		exporter := &MultiExporter{outputs: []output{{"output 1 (file)", failing}, {"output 2 (console)", counting}}, failFast: true}
+
+		err := exporter.WriteMessage(msg)
+		if !errors.Is(err, ErrOutputFailed) {
+			t.Errorf("Expected ErrOutputFailed, got %v", err)
+		}
+		var exporterErr *ExporterError
+		if !errors.As(err, &exporterErr) || exporterErr.Type != ErrorTypeFileIO {
+			t.Errorf("Expected the output error to be wrapped, got %v", err)
+		}
+		if counting.writes != 0 {
+			t.Error("Expected the fan-out to stop at the first failure")
+		}
+
+		exporter.Close()
+		if !counting.closed {
+			t.Error("Expected every output to be closed")
+		}
+	})
+}
+
+func TestNewMultiExporter_InvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		err  string
+	}{
+		{
+			name: "unknown mode",
+			cfg:  &config.Config{OutputErrors: "retry", Outputs: []config.OutputConfig{{Writer: "console"}}},
+			err:  "invalid output error mode",
+		},
+		{
+			name: "same file twice",
+			cfg: &config.Config{
+				OutputFile: filepath.Join(dir, "dump.json"),
+				Outputs:    []config.OutputConfig{{Writer: "file"}, {Writer: "csv"}},
+			},
+			err: "output 1 (file) and output 2 (csv) both write to",
+		},
+		{
+			name: "unknown writer",
+			cfg:  &config.Config{Outputs: []config.OutputConfig{{Writer: "console"}, {Writer: "kafka"}}},
+			err:  "output 2 (kafka)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMultiExporter(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,425 @@
+package exporter
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/marianozunino/goq/internal/config"
+)
+
+// Compression of rotated segments accepted by --rotate-compress
+const (
+	RotateCompressGzip = "gzip"
+	RotateCompressZstd = "zstd"
+)
+
+// defaultTimeLayout is used by a {time} placeholder without a layout
+const defaultTimeLayout = "20060102T150405"
+
+// timePlaceholder matches {time} and {time:LAYOUT} in output file names,
+// LAYOUT being a Go time layout such as 2006-01-02
+var timePlaceholder = regexp.MustCompile(`\{time(?::([^}]*))?\}`)
+
+// expandOutputName replaces the time placeholders of an output file name
+func expandOutputName(pattern string, t time.Time) string {
+	return timePlaceholder.ReplaceAllStringFunc(pattern, func(match string) string {
+		layout := timePlaceholder.FindStringSubmatch(match)[1]
+		if layout == "" {
+			layout = defaultTimeLayout
+		}
+		return t.Format(layout)
+	})
+}
+
+// openOutput opens an output file according to the file mode
+func openOutput(path, fileMode string) (*os.File, error) {
+	var file *os.File
+	var err error
+
+	switch fileMode {
+	case "append":
+		file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	case "overwrite", "":
+		file, err = os.Create(path)
+	default:
+		return nil, &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  fmt.Errorf("invalid file mode: %s (use 'append' or 'overwrite')", fileMode),
+		}
+	}
+	if err != nil {
+		return nil, &ExporterError{
+			Type: ErrorTypeFileIO,
+			Err:  fmt.Errorf("failed to open/create output file: %v", err),
+		}
+	}
+	return file, nil
+}
+
+// parseSize converts a size such as "100MB", "1.5G" or "4096" into bytes.
+// KB, MB and GB are powers of 1024.
+func parseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 512KB, 100MB or 1GB)", size)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// rotation splits the output of a FileExporter into segments, by size and
+// by age. Rotated segments are compressed and pruned in the background so
+// writing never waits on them.
+type rotation struct {
+	pattern  string
+	maxSize  int64
+	every    time.Duration
+	keep     int
+	compress string
+
+	size     int64
+	openedAt time.Time
+
+	// segments lists the rotated segments, oldest first. It is only used
+	// by the background worker once the exporter is running.
+	segments []string
+	jobs     chan string
+	wg       sync.WaitGroup
+}
+
+// newRotation returns the rotation settings of cfg, or nil when rotation is
+// disabled
+func newRotation(cfg *config.Config) (*rotation, error) {
+	if cfg.RotateSize == "" && cfg.RotateEvery <= 0 {
+		if cfg.RotateKeep > 0 || cfg.RotateCompress != "" {
+			return nil, &ExporterError{
+				Type: ErrorTypeConfiguration,
+				Err:  fmt.Errorf("--rotate-keep and --rotate-compress need --rotate-size or --rotate-every"),
+			}
+		}
+		return nil, nil
+	}
+
+	r := &rotation{
+		pattern:  cfg.OutputFile,
+		every:    cfg.RotateEvery,
+		keep:     cfg.RotateKeep,
+		compress: cfg.RotateCompress,
+	}
+
+	if cfg.RotateSize != "" {
+		size, err := parseSize(cfg.RotateSize)
+		if err != nil {
+			return nil, &ExporterError{Type: ErrorTypeConfiguration, Err: err}
+		}
+		r.maxSize = size
+	}
+
+	switch r.compress {
+	case "", RotateCompressGzip, RotateCompressZstd:
+	default:
+		return nil, &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  fmt.Errorf("invalid rotate compression: %s (use %s or %s)", r.compress, RotateCompressGzip, RotateCompressZstd),
+		}
+	}
+
+	if r.keep < 0 {
+		return nil, &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  fmt.Errorf("--rotate-keep must be 0 (keep all) or a positive number"),
+		}
+	}
+
+	return r, nil
+}
+
+// start records the segment being written and launches the worker that
+// compresses and prunes rotated segments
+func (r *rotation) start(current *os.File) {
+	r.openedAt = time.Now()
+	if info, err := current.Stat(); err == nil {
+		r.size = info.Size()
+	}
+
+	// Segments left by a previous run count towards the cap
+	if r.keep > 0 {
+		r.segments = r.existingSegments(current.Name())
+	}
+
+	r.jobs = make(chan string, 16)
+	r.wg.Add(1)
+	go r.work()
+}
+
+// due reports whether the current segment must be rotated before writing n
+// more bytes. An empty segment is never rotated.
+func (r *rotation) due(n int) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.maxSize > 0 && r.size+int64(n) > r.maxSize {
+		return true
+	}
+	return r.every > 0 && time.Since(r.openedAt) >= r.every
+}
+
+// rotate closes the current segment and returns the next one
+func (r *rotation) rotate(current *os.File) (*os.File, error) {
+	currentPath := current.Name()
+	if err := current.Close(); err != nil {
+		return nil, &ExporterError{
+			Type: ErrorTypeFileIO,
+			Err:  fmt.Errorf("failed to close segment: %v", err),
+		}
+	}
+
+	rotated := currentPath
+	if !timePlaceholder.MatchString(r.pattern) {
+		// A fixed name keeps pointing at the live segment, the rotated one
+		// is renamed after the time it was started
+		rotated = uniquePath(timestampedName(currentPath, r.openedAt))
+		if err := os.Rename(currentPath, rotated); err != nil {
+			return nil, &ExporterError{
+				Type: ErrorTypeFileIO,
+				Err:  fmt.Errorf("failed to rename segment: %v", err),
+			}
+		}
+	}
+
+	next := expandOutputName(r.pattern, time.Now())
+	if next != r.pattern {
+		next = uniquePath(next)
+	}
+	file, err := openOutput(next, "overwrite")
+	if err != nil {
+		return nil, err
+	}
+
+	r.size = 0
+	r.openedAt = time.Now()
+	r.jobs <- rotated
+	return file, nil
+}
+
+// close waits for the pending compressions
+func (r *rotation) close() {
+	close(r.jobs)
+	r.wg.Wait()
+}
+
+func (r *rotation) work() {
+	defer r.wg.Done()
+	for segment := range r.jobs {
+		if r.compress != "" {
+			compressed, err := compressSegment(segment, r.compress)
+			if err != nil {
+				log.Printf("Failed to compress %s: %v", segment, err)
+			} else {
+				segment = compressed
+			}
+		}
+
+		r.segments = append(r.segments, segment)
+		for r.keep > 0 && len(r.segments) > r.keep {
+			if err := os.Remove(r.segments[0]); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to remove old segment %s: %v", r.segments[0], err)
+			}
+			r.segments = r.segments[1:]
+		}
+	}
+}
+
+// existingSegments finds the rotated segments of a previous run, oldest
+// first
+func (r *rotation) existingSegments(current string) []string {
+	glob := timePlaceholder.ReplaceAllString(r.pattern, "*")
+	if glob == r.pattern {
+		glob = timestampedName(r.pattern, time.Time{})
+		glob = strings.Replace(glob, time.Time{}.Format(defaultTimeLayout), "*", 1)
+	}
+
+	matches, _ := filepath.Glob(glob + "*")
+	isSegment := segmentMatcher(r.pattern)
+	type segment struct {
+		path    string
+		modTime time.Time
+	}
+	var found []segment
+	for _, match := range matches {
+		// The glob also matches unrelated files such as events-backup.json
+		if match == current || !isSegment(match) {
+			continue
+		}
+		if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+			found = append(found, segment{match, info.ModTime()})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.Before(found[j].modTime) })
+
+	segments := make([]string, len(found))
+	for i, s := range found {
+		segments[i] = s.path
+	}
+	return segments
+}
+
+// segmentMatcher returns whether a file name is a segment of pattern: its
+// time placeholders, or the timestamp inserted into a fixed name, parse with
+// their layout, optionally followed by the counter of uniquePath and the
+// extension of a compressed segment. Only base names are compared, the glob
+// already matched the directory.
+func segmentMatcher(pattern string) func(string) bool {
+	pattern = filepath.Base(pattern)
+	if !timePlaceholder.MatchString(pattern) {
+		ext := filepath.Ext(pattern)
+		pattern = strings.TrimSuffix(pattern, ext) + "-{time}" + ext
+	}
+	ext := filepath.Ext(pattern)
+	if strings.ContainsAny(ext, "{}") {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(pattern, ext)
+
+	var expr strings.Builder
+	var layouts []string
+	last := 0
+	for _, loc := range timePlaceholder.FindAllStringSubmatchIndex(stem, -1) {
+		layout := defaultTimeLayout
+		if loc[2] >= 0 && loc[3] > loc[2] {
+			layout = stem[loc[2]:loc[3]]
+		}
+		layouts = append(layouts, layout)
+		expr.WriteString(regexp.QuoteMeta(stem[last:loc[0]]) + "(.+)")
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(stem[last:]))
+	named := regexp.MustCompile("^" + expr.String() + "$")
+	counter := regexp.MustCompile(`-\d+$`)
+
+	matches := func(name string) bool {
+		m := named.FindStringSubmatch(name)
+		if m == nil {
+			return false
+		}
+		for i, layout := range layouts {
+			if _, err := time.Parse(layout, m[i+1]); err != nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	return func(path string) bool {
+		name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".gz"), ".zst")
+		if !strings.HasSuffix(name, ext) {
+			return false
+		}
+		name = strings.TrimSuffix(name, ext)
+		return matches(name) || (counter.MatchString(name) && matches(counter.ReplaceAllString(name, "")))
+	}
+}
+
+// timestampedName inserts a timestamp before the extension of a file name:
+// dump.json becomes dump-20240102T150405.json
+func timestampedName(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + t.Format(defaultTimeLayout) + ext
+}
+
+// uniquePath appends a counter to a file name that is already taken, by the
+// file itself or by its compressed version
+func uniquePath(path string) string {
+	if !pathTaken(path) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", stem, i, ext)
+		if !pathTaken(candidate) {
+			return candidate
+		}
+	}
+}
+
+func pathTaken(path string) bool {
+	for _, candidate := range []string{path, path + ".gz", path + ".zst"} {
+		if _, err := os.Stat(candidate); !os.IsNotExist(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressSegment compresses a rotated segment next to it and removes the
+// original
+func compressSegment(path, algorithm string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	target := path + ".gz"
+	if algorithm == RotateCompressZstd {
+		target = path + ".zst"
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return "", err
+	}
+
+	var w io.WriteCloser
+	if algorithm == RotateCompressZstd {
+		w, err = zstd.NewWriter(out)
+		if err != nil {
+			out.Close()
+			os.Remove(target)
+			return "", err
+		}
+	} else {
+		w = gzip.NewWriter(out)
+	}
+
+	_, err = io.Copy(w, in)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(target)
+		return "", err
+	}
+
+	in.Close()
+	return target, os.Remove(path)
+}
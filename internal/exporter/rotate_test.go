@@ -0,0 +1,297 @@
+package exporter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected int64
+	}{
+		{"4096", 4096},
+		{"100B", 100},
+		{"512KB", 512 << 10},
+		{"100MB", 100 << 20},
+		{"100mb", 100 << 20},
+		{"1.5G", 3 << 29},
+		{"2MiB", 2 << 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			size, err := parseSize(tt.size)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if size != tt.expected {
+				t.Errorf("Expected %d bytes, got %d", tt.expected, size)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", "MB", "-1MB", "ten"} {
+		if _, err := parseSize(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestExpandOutputName(t *testing.T) {
+	at := time.Date(2024, 3, 9, 14, 5, 7, 0, time.UTC)
+
+	tests := map[string]string{
+		"dump.json":                     "dump.json",
+		"dump-{time}.json":              "dump-20240309T140507.json",
+		"logs/{time:2006-01-02}/a.json": "logs/2024-03-09/a.json",
+	}
+	for pattern, expected := range tests {
+		if got := expandOutputName(pattern, at); got != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, pattern, got)
+		}
+	}
+}
+
+func TestNewRotation_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+	}{
+		{name: "invalid size", cfg: &config.Config{RotateSize: "lots"}},
+		{name: "invalid compression", cfg: &config.Config{RotateSize: "1MB", RotateCompress: "bzip2"}},
+		{name: "negative keep", cfg: &config.Config{RotateEvery: time.Hour, RotateKeep: -1}},
+		{name: "keep without rotation", cfg: &config.Config{RotateKeep: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newRotation(tt.cfg); err == nil {
+				t.Error("Expected configuration error")
+			}
+		})
+	}
+
+	if r, err := newRotation(&config.Config{}); err != nil || r != nil {
+		t.Errorf("Expected rotation to be disabled, got %v, %v", r, err)
+	}
+}
+
+func writeMessages(t *testing.T, cfg *config.Config, count int) {
+	t.Helper()
+	exporter, err := NewFileWriter(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create file writer: %v", err)
+	}
+
+	var msg rabbitmq.Delivery
+	msg.RoutingKey = "key"
+	msg.Body = []byte(`{"padding": "` + strings.Repeat("x", 100) + `"}`)
+	for i := 0; i < count; i++ {
+		if err := exporter.WriteMessage(msg); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("Failed to close file writer: %v", err)
+	}
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to list output directory: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	switch filepath.Ext(path) {
+	case ".gz":
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("Failed to read gzip segment: %v", err)
+		}
+		r = gz
+	case ".zst":
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			t.Fatalf("Failed to read zstd segment: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	lines := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
+
+func TestFileExporter_RotateSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dump.json")
+
+	// Every message is around 200 bytes, so each segment holds 5 of them
+	writeMessages(t, &config.Config{OutputFile: path, RotateSize: "1KB"}, 12)
+
+	names := listDir(t, dir)
+	if len(names) != 3 {
+		t.Fatalf("Expected the live file and two rotated segments, got %v", names)
+	}
+
+	total := 0
+	for _, name := range names {
+		lines := countLines(t, filepath.Join(dir, name))
+		if name != "dump.json" && lines != 5 {
+			t.Errorf("Expected full rotated segment %s, got %d lines", name, lines)
+		}
+		total += lines
+	}
+	if total != 12 {
+		t.Errorf("Expected every message to be written once, got %d", total)
+	}
+}
+
+func TestFileExporter_RotateKeepAndCompress(t *testing.T) {
+	for _, algorithm := range []string{RotateCompressGzip, RotateCompressZstd} {
+		t.Run(algorithm, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &config.Config{
+				OutputFile:     filepath.Join(dir, "dump.json"),
+				RotateSize:     "1KB",
+				RotateKeep:     2,
+				RotateCompress: algorithm,
+			}
+			writeMessages(t, cfg, 30)
+
+			names := listDir(t, dir)
+			if len(names) != 3 {
+				t.Fatalf("Expected the live file and two kept segments, got %v", names)
+			}
+
+			ext := map[string]string{RotateCompressGzip: ".gz", RotateCompressZstd: ".zst"}[algorithm]
+			for _, name := range names {
+				if name == "dump.json" {
+					continue
+				}
+				if !strings.HasSuffix(name, ".json"+ext) {
+					t.Errorf("Expected compressed segment, got %s", name)
+				}
+				if lines := countLines(t, filepath.Join(dir, name)); lines != 5 {
+					t.Errorf("Expected 5 messages in %s, got %d", name, lines)
+				}
+			}
+
+			// A new run counts the segments it finds towards the cap
+			writeMessages(t, cfg, 10)
+			if names := listDir(t, dir); len(names) != 3 {
+				t.Errorf("Expected the cap to hold across runs, got %v", names)
+			}
+		})
+	}
+}
+
+func TestFileExporter_RotateEveryWithTimePattern(t *testing.T) {
+	dir := t.TempDir()
+	exporter, err := NewFileWriter(&config.Config{
+		OutputFile:  filepath.Join(dir, "dump-{time:150405.000}.json"),
+		RotateEvery: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create file writer: %v", err)
+	}
+
+	var msg rabbitmq.Delivery
+	msg.Body = []byte(`{}`)
+	for i := 0; i < 3; i++ {
+		if err := exporter.WriteMessage(msg); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+		time.Sleep(30 * time.Millisecond)
+	}
+	exporter.Close()
+
+	names := listDir(t, dir)
+	if len(names) != 3 {
+		t.Fatalf("Expected one file per interval, got %v", names)
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, "dump-") || name == "dump-{time:150405.000}.json" {
+			t.Errorf("Expected a timestamped file name, got %s", name)
+		}
+	}
+}
+
+func TestSegmentMatcher(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{pattern: "out/events-{time}.json", path: "out/events-20240102T150405.json", expected: true},
+		{pattern: "out/events-{time}.json", path: "out/events-20240102T150405-2.json.gz", expected: true},
+		{pattern: "out/events-{time}.json", path: "out/events-20240102T150405.json.zst", expected: true},
+		{pattern: "out/events-{time}.json", path: "out/events-backup.json", expected: false},
+		{pattern: "out/events-{time}.json", path: "out/events-20240102T150405.json.bak", expected: false},
+		{pattern: "events-{time:2006-01-02}.json", path: "events-2024-01-02.json", expected: true},
+		{pattern: "events-{time:2006-01-02}.json", path: "events-2024-01-02-1.json", expected: true},
+		{pattern: "events-{time:2006-01-02}.json", path: "events-old-copy.json", expected: false},
+		{pattern: "./dump.json", path: "dump-20240102T150405.json", expected: true},
+		{pattern: "dump.json", path: "dump-final.json", expected: false},
+	}
+
+	for _, tt := range tests {
+		if got := segmentMatcher(tt.pattern)(tt.path); got != tt.expected {
+			t.Errorf("Expected %s to be a segment of %s: %v, got %v", tt.path, tt.pattern, tt.expected, got)
+		}
+	}
+}
+
+func TestFileExporter_RotateKeepSparesUnrelatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "dump-backup.json")
+	if err := os.WriteFile(backup, []byte("keep me\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cfg := &config.Config{
+		OutputFile: filepath.Join(dir, "dump.json"),
+		RotateSize: "1KB",
+		RotateKeep: 1,
+	}
+	writeMessages(t, cfg, 30)
+	// A new run adopts the segments of the previous one, and only those
+	writeMessages(t, cfg, 30)
+
+	if _, err := os.Stat(backup); err != nil {
+		t.Errorf("Expected the unrelated file matching the segment glob to be kept, got %v", err)
+	}
+}
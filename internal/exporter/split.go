@@ -0,0 +1,250 @@
+package exporter
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/itchyny/gojq"
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+// Split keys accepted by --split-by, besides header:<name> and jq:<expr>
+const (
+	SplitByRoutingKey = "routingKey"
+	SplitByExchange   = "exchange"
+)
+
+// defaultSplitMaxOpen bounds the open files when --split-max-open is not set
+const defaultSplitMaxOpen = 64
+
+// emptySplitKey names the file of messages without a key
+const emptySplitKey = "_none"
+
+// SplitExporter writes every message to the file of its key, such as its
+// routing key. Files are opened on demand and the least recently used one
+// is closed when too many are open; it is appended to if its key shows up
+// again.
+type SplitExporter struct {
+	config  *config.Config
+	output  *template.Template
+	key     func(msg rabbitmq.Delivery) (string, error)
+	maxOpen int
+
+	open  map[string]*list.Element
+	lru   *list.List
+	paths map[string]bool
+}
+
+// splitFile is an open file of the pool
+type splitFile struct {
+	key      string
+	exporter *FileExporter
+}
+
+var _ Exporter = &SplitExporter{}
+
+func NewSplitExporter(cfg *config.Config) (*SplitExporter, error) {
+	if cfg.Writer != config.FileWriterKind {
+		return nil, &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  fmt.Errorf("--split-by needs the file writer"),
+		}
+	}
+
+	output, err := template.New("output").Option("missingkey=error").Parse(cfg.OutputFile)
+	if err != nil {
+		return nil, &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  fmt.Errorf("invalid output file template: %v", err),
+		}
+	}
+
+	w := &SplitExporter{
+		config:  cfg,
+		output:  output,
+		maxOpen: cfg.SplitMaxOpen,
+		open:    map[string]*list.Element{},
+		lru:     list.New(),
+		paths:   map[string]bool{},
+	}
+	if w.maxOpen <= 0 {
+		w.maxOpen = defaultSplitMaxOpen
+	}
+
+	first, err := w.path("a")
+	if err != nil {
+		return nil, err
+	}
+	if second, _ := w.path("b"); first == second {
+		return nil, &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  fmt.Errorf("the output file must include {{.Key}} when splitting, e.g. 'out/{{.Key}}.ndjson'"),
+		}
+	}
+
+	w.key, err = splitKeyFunc(cfg)
+	if err != nil {
+		return nil, &ExporterError{Type: ErrorTypeConfiguration, Err: err}
+	}
+
+	return w, nil
+}
+
+func (w *SplitExporter) WriteMessage(msg rabbitmq.Delivery) error {
+	key, err := w.key(msg)
+	if err != nil {
+		return &ExporterError{Type: ErrorTypeTransform, Err: err}
+	}
+
+	exporter, err := w.exporter(key)
+	if err != nil {
+		return err
+	}
+	return exporter.WriteMessage(msg)
+}
+
+func (w *SplitExporter) Close() error {
+	var firstErr error
+	for e := w.lru.Front(); e != nil; e = e.Next() {
+		if err := e.Value.(*splitFile).exporter.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	w.lru.Init()
+	w.open = map[string]*list.Element{}
+	return firstErr
+}
+
+// exporter returns the open file of a key, opening it (and closing the least
+// recently used file if the pool is full) when needed
+func (w *SplitExporter) exporter(key string) (*FileExporter, error) {
+	if e, ok := w.open[key]; ok {
+		w.lru.MoveToFront(e)
+		return e.Value.(*splitFile).exporter, nil
+	}
+
+	if w.lru.Len() >= w.maxOpen {
+		oldest := w.lru.Back()
+		file := w.lru.Remove(oldest).(*splitFile)
+		delete(w.open, file.key)
+		if err := file.exporter.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	path, err := w.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, &ExporterError{
+			Type: ErrorTypeFileIO,
+			Err:  fmt.Errorf("failed to create output directory: %v", err),
+		}
+	}
+
+	fileCfg := *w.config
+	fileCfg.OutputFile = path
+	// A file closed to make room is reopened where it was left
+	if w.paths[path] {
+		fileCfg.FileMode = "append"
+	}
+
+	exporter, err := NewFileWriter(&fileCfg)
+	if err != nil {
+		return nil, err
+	}
+	w.paths[path] = true
+	w.open[key] = w.lru.PushFront(&splitFile{key: key, exporter: exporter})
+	return exporter, nil
+}
+
+// path renders the output file of a key
+func (w *SplitExporter) path(key string) (string, error) {
+	var buf bytes.Buffer
+	if err := w.output.Execute(&buf, struct{ Key string }{sanitizeKey(key)}); err != nil {
+		return "", &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  fmt.Errorf("invalid output file template: %v", err),
+		}
+	}
+	return buf.String(), nil
+}
+
+// splitKeyFunc returns the function computing the key of a message
+func splitKeyFunc(cfg *config.Config) (func(msg rabbitmq.Delivery) (string, error), error) {
+	splitBy := cfg.SplitBy
+
+	switch {
+	case splitBy == SplitByRoutingKey:
+		return func(msg rabbitmq.Delivery) (string, error) { return msg.RoutingKey, nil }, nil
+	case splitBy == SplitByExchange:
+		return func(msg rabbitmq.Delivery) (string, error) { return msg.Exchange, nil }, nil
+	case strings.HasPrefix(splitBy, "header:"):
+		name := strings.TrimPrefix(splitBy, "header:")
+		if name == "" {
+			return nil, fmt.Errorf("--split-by header: needs a header name")
+		}
+		return func(msg rabbitmq.Delivery) (string, error) {
+			value, ok := msg.Headers[name]
+			if !ok || value == nil {
+				return "", nil
+			}
+			return fmt.Sprint(value), nil
+		}, nil
+	case strings.HasPrefix(splitBy, "jq:"):
+		query, err := gojq.Parse(strings.TrimPrefix(splitBy, "jq:"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid --split-by expression: %v", err)
+		}
+		c := column{name: "split-by", query: query}
+		return func(msg rabbitmq.Delivery) (string, error) {
+			records, err := exportRecords(msg, cfg, nil)
+			if err != nil {
+				return "", err
+			}
+			return evaluateColumn(c, records[0])
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid --split-by %q (use %s, %s, header:<name> or jq:<expr>)", splitBy, SplitByRoutingKey, SplitByExchange)
+	}
+}
+
+// sanitizeKey makes a key safe to use as a file name. A key that has to be
+// changed gets a hash of the original appended, so it cannot share a file
+// with another key, such as a/b with a_b, or with messages without a key.
+func sanitizeKey(key string) string {
+	if key == "" {
+		return emptySplitKey
+	}
+
+	safe := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', 0:
+			return '_'
+		}
+		return r
+	}, key)
+	if safe == "." || safe == ".." {
+		safe = strings.Repeat("_", len(safe))
+	}
+
+	if safe == key && key != emptySplitKey {
+		return key
+	}
+	return safe + "-" + keyHash(key)
+}
+
+// keyHash returns a short hash of a key
+func keyHash(key string) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
@@ -0,0 +1,195 @@
+package exporter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+func delivery(exchange, routingKey string, headers amqp091.Table, body string) rabbitmq.Delivery {
+	var msg rabbitmq.Delivery
+	msg.Exchange = exchange
+	msg.RoutingKey = routingKey
+	msg.Headers = headers
+	msg.Body = []byte(body)
+	return msg
+}
+
+func TestSplitExporter_Keys(t *testing.T) {
+	deliveries := []rabbitmq.Delivery{
+		delivery("orders", "orders.created", amqp091.Table{"x-tenant": "acme"}, `{"region": "eu"}`),
+		delivery("orders", "orders.cancelled", amqp091.Table{"x-tenant": "globex"}, `{"region": "us"}`),
+		delivery("users", "orders.created", nil, `{"region": "eu"}`),
+	}
+
+	tests := []struct {
+		splitBy  string
+		expected map[string]int
+	}{
+		{splitBy: "routingKey", expected: map[string]int{"orders.created.ndjson": 2, "orders.cancelled.ndjson": 1}},
+		{splitBy: "exchange", expected: map[string]int{"orders.ndjson": 2, "users.ndjson": 1}},
+		{splitBy: "header:x-tenant", expected: map[string]int{"acme.ndjson": 1, "globex.ndjson": 1, "_none.ndjson": 1}},
+		{splitBy: "jq:.body.region", expected: map[string]int{"eu.ndjson": 2, "us.ndjson": 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.splitBy, func(t *testing.T) {
+			dir := t.TempDir()
+			exporter, err := NewExporter(&config.Config{
+				Writer:     config.FileWriterKind,
+				OutputFile: filepath.Join(dir, "out", "{{.Key}}.ndjson"),
+				SplitBy:    tt.splitBy,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create exporter: %v", err)
+			}
+
+			for _, d := range deliveries {
+				if err := exporter.WriteMessage(d); err != nil {
+					t.Fatalf("Failed to write message: %v", err)
+				}
+			}
+			if err := exporter.Close(); err != nil {
+				t.Fatalf("Failed to close exporter: %v", err)
+			}
+
+			got := map[string]int{}
+			for _, name := range listDir(t, filepath.Join(dir, "out")) {
+				got[name] = countLines(t, filepath.Join(dir, "out", name))
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected files %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSplitExporter_LRU(t *testing.T) {
+	dir := t.TempDir()
+	exporter, err := NewSplitExporter(&config.Config{
+		Writer:       config.FileWriterKind,
+		OutputFile:   filepath.Join(dir, "{{.Key}}.ndjson"),
+		SplitBy:      "routingKey",
+		SplitMaxOpen: 2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+
+	for _, key := range []string{"a", "b", "a", "c", "b", "a"} {
+		if err := exporter.WriteMessage(delivery("", key, nil, "{}")); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+		if exporter.lru.Len() > 2 {
+			t.Fatalf("Expected at most 2 open files, got %d", exporter.lru.Len())
+		}
+	}
+
+	// "b" and then "a" were closed to make room, their later messages are
+	// appended
+	for _, key := range []string{"a", "b"} {
+		if _, ok := exporter.open[key]; !ok {
+			t.Errorf("Expected recently used key %q to stay open", key)
+		}
+	}
+	exporter.Close()
+
+	expected := map[string]int{"a.ndjson": 3, "b.ndjson": 2, "c.ndjson": 1}
+	for name, lines := range expected {
+		if got := countLines(t, filepath.Join(dir, name)); got != lines {
+			t.Errorf("Expected %d messages in %s, got %d", lines, name, got)
+		}
+	}
+}
+
+func TestSplitExporter_SanitizesKeys(t *testing.T) {
+	dir := t.TempDir()
+	exporter, err := NewSplitExporter(&config.Config{
+		Writer:     config.FileWriterKind,
+		OutputFile: filepath.Join(dir, "{{.Key}}.ndjson"),
+		SplitBy:    "routingKey",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+
+	for _, key := range []string{"../escape", ".."} {
+		if err := exporter.WriteMessage(delivery("", key, nil, "{}")); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+	}
+	exporter.Close()
+
+	names := listDir(t, dir)
+	expected := []string{".._escape-" + keyHash("../escape") + ".ndjson", "__-" + keyHash("..") + ".ndjson"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected files %v, got %v", expected, names)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape.ndjson")); err == nil {
+		t.Error("Expected keys not to escape the output directory")
+	}
+}
+
+func TestSplitExporter_SanitizedKeysDoNotCollide(t *testing.T) {
+	dir := t.TempDir()
+	exporter, err := NewSplitExporter(&config.Config{
+		Writer:     config.FileWriterKind,
+		OutputFile: filepath.Join(dir, "{{.Key}}.ndjson"),
+		SplitBy:    "routingKey",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+
+	for _, key := range []string{"a/b", "a_b", "a\\b", "", "_none"} {
+		if err := exporter.WriteMessage(delivery("", key, nil, "{}")); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+	}
+	exporter.Close()
+
+	names := listDir(t, dir)
+	if len(names) != 5 {
+		t.Fatalf("Expected one file per key, got %v", names)
+	}
+	for _, name := range names {
+		if got := countLines(t, filepath.Join(dir, name)); got != 1 {
+			t.Errorf("Expected 1 message in %s, got %d", name, got)
+		}
+	}
+	if sanitizeKey("a_b") != "a_b" || sanitizeKey("a/b") != "a_b-"+keyHash("a/b") {
+		t.Errorf("Expected only changed keys to get a hash, got %q and %q", sanitizeKey("a_b"), sanitizeKey("a/b"))
+	}
+}
+
+func TestNewSplitExporter_InvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		err  string
+	}{
+		{name: "console writer", cfg: &config.Config{Writer: config.ConsoleExporterKind, SplitBy: "routingKey"}, err: "file writer"},
+		{name: "output without key", cfg: &config.Config{Writer: config.FileWriterKind, OutputFile: filepath.Join(dir, "out.ndjson"), SplitBy: "routingKey"}, err: "{{.Key}}"},
+		{name: "invalid template", cfg: &config.Config{Writer: config.FileWriterKind, OutputFile: "{{.Key", SplitBy: "routingKey"}, err: "template"},
+		{name: "unknown field", cfg: &config.Config{Writer: config.FileWriterKind, OutputFile: "{{.Tenant}}", SplitBy: "routingKey"}, err: "template"},
+		{name: "unknown split", cfg: &config.Config{Writer: config.FileWriterKind, OutputFile: "{{.Key}}", SplitBy: "queue"}, err: "invalid --split-by"},
+		{name: "header without name", cfg: &config.Config{Writer: config.FileWriterKind, OutputFile: "{{.Key}}", SplitBy: "header:"}, err: "header name"},
+		{name: "invalid jq", cfg: &config.Config{Writer: config.FileWriterKind, OutputFile: "{{.Key}}", SplitBy: "jq:.body["}, err: "expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSplitExporter(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
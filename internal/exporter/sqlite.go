@@ -0,0 +1,281 @@
+package exporter
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/wagslane/go-rabbitmq"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	// sqliteBatchSize is the number of rows inserted per transaction
+	sqliteBatchSize = 500
+	// sqliteBatchInterval bounds how long rows wait uncommitted for their
+	// batch to fill
+	sqliteBatchInterval = time.Second
+)
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS messages (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	exchange    TEXT NOT NULL,
+	routing_key TEXT NOT NULL,
+	timestamp   INTEGER,
+	exported_at TEXT NOT NULL,
+	properties  TEXT NOT NULL,
+	headers     TEXT,
+	body        BLOB
+);
+CREATE INDEX IF NOT EXISTS messages_routing_key ON messages (routing_key);`
+
+const sqliteInsert = `INSERT INTO messages
+	(exchange, routing_key, timestamp, exported_at, properties, headers, body)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+func init() {
+	RegisterExporterFactory(string(config.SQLiteExporterKind), &SQLiteExporterFactory{})
+}
+
+// SQLiteExporterFactory creates SQLite exporters
+type SQLiteExporterFactory struct{}
+
+func (f *SQLiteExporterFactory) GetType() string {
+	return string(config.SQLiteExporterKind)
+}
+
+func (f *SQLiteExporterFactory) CreateExporter(cfg *config.Config) (Exporter, error) {
+	return NewSQLiteExporter(cfg)
+}
+
+// SQLiteExporter writes one row per message into the messages table of a
+// SQLite database. Rows are inserted in batched transactions; a batch is
+// committed once it is full, a second after it was started even when no
+// other message arrives, and on Close.
+type SQLiteExporter struct {
+	mu       sync.Mutex
+	db       *sql.DB
+	tx       *sql.Tx
+	insert   *sql.Stmt
+	pending  int
+	interval time.Duration
+	timer    *time.Timer
+	// err is a failed timed commit, reported by the next write or Close
+	err error
+}
+
+var _ Exporter = &SQLiteExporter{}
+
+func NewSQLiteExporter(cfg *config.Config) (*SQLiteExporter, error) {
+	path := expandOutputName(cfg.OutputFile, time.Now())
+	if path == "" {
+		return nil, &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  fmt.Errorf("an output file is required for the sqlite writer"),
+		}
+	}
+
+	switch cfg.FileMode {
+	case "append":
+	case "overwrite", "":
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, &ExporterError{
+				Type: ErrorTypeFileIO,
+				Err:  fmt.Errorf("failed to remove existing database: %v", err),
+			}
+		}
+	default:
+		return nil, &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  fmt.Errorf("invalid file mode: %s (use 'append' or 'overwrite')", cfg.FileMode),
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, &ExporterError{
+			Type: ErrorTypeDatabase,
+			Err:  fmt.Errorf("failed to open database: %v", err),
+		}
+	}
+	// A single connection keeps the batch transaction and the schema on the
+	// same SQLite handle
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, &ExporterError{
+			Type: ErrorTypeDatabase,
+			Err:  fmt.Errorf("failed to create schema: %v", err),
+		}
+	}
+
+	return &SQLiteExporter{db: db, interval: sqliteBatchInterval}, nil
+}
+
+func (w *SQLiteExporter) WriteMessage(msg rabbitmq.Delivery) error {
+	message := newMessage(msg, true)
+
+	properties, err := json.Marshal(message.Properties)
+	if err != nil {
+		return &ExporterError{
+			Type: ErrorTypeSerialization,
+			Err:  fmt.Errorf("failed to marshal properties: %v", err),
+		}
+	}
+
+	var headers interface{}
+	if message.Headers != nil {
+		encoded, err := json.Marshal(message.Headers)
+		if err != nil {
+			return &ExporterError{
+				Type: ErrorTypeSerialization,
+				Err:  fmt.Errorf("failed to marshal headers: %v", err),
+			}
+		}
+		headers = string(encoded)
+	}
+
+	var timestamp interface{}
+	if message.Timestamp != 0 {
+		timestamp = message.Timestamp
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.takeErr(); err != nil {
+		return err
+	}
+
+	if w.tx == nil {
+		if err := w.begin(); err != nil {
+			return err
+		}
+	}
+
+	_, err = w.insert.Exec(
+		message.Exchange,
+		message.RoutingKey,
+		timestamp,
+		time.Now().UTC().Format(time.RFC3339Nano),
+		string(properties),
+		headers,
+		sqliteBody(msg.Body),
+	)
+	if err != nil {
+		return &ExporterError{
+			Type: ErrorTypeDatabase,
+			Err:  fmt.Errorf("failed to insert message: %v", err),
+		}
+	}
+
+	w.pending++
+	if w.pending >= sqliteBatchSize {
+		return w.commit()
+	}
+	return nil
+}
+
+func (w *SQLiteExporter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.takeErr()
+	if commitErr := w.commit(); err == nil {
+		err = commitErr
+	}
+	if err != nil {
+		w.db.Close()
+		return err
+	}
+	if err := w.db.Close(); err != nil {
+		return &ExporterError{
+			Type: ErrorTypeDatabase,
+			Err:  fmt.Errorf("failed to close database: %v", err),
+		}
+	}
+	return nil
+}
+
+// begin starts a new batch
+func (w *SQLiteExporter) begin() error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return &ExporterError{
+			Type: ErrorTypeDatabase,
+			Err:  fmt.Errorf("failed to begin transaction: %v", err),
+		}
+	}
+	insert, err := tx.Prepare(sqliteInsert)
+	if err != nil {
+		tx.Rollback()
+		return &ExporterError{
+			Type: ErrorTypeDatabase,
+			Err:  fmt.Errorf("failed to prepare insert: %v", err),
+		}
+	}
+
+	w.tx = tx
+	w.insert = insert
+	w.pending = 0
+	w.timer = time.AfterFunc(w.interval, w.flush)
+	return nil
+}
+
+// flush commits the current batch once its interval is over, so rows of a
+// quiet session do not wait for the next message
+func (w *SQLiteExporter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.commit(); err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+// takeErr returns and clears the error of a timed commit
+func (w *SQLiteExporter) takeErr() error {
+	err := w.err
+	w.err = nil
+	return err
+}
+
+// commit writes the current batch, if any
+func (w *SQLiteExporter) commit() error {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if w.tx == nil {
+		return nil
+	}
+
+	w.insert.Close()
+	err := w.tx.Commit()
+	w.tx = nil
+	w.insert = nil
+	w.pending = 0
+
+	if err != nil {
+		return &ExporterError{
+			Type: ErrorTypeDatabase,
+			Err:  fmt.Errorf("failed to commit batch: %v", err),
+		}
+	}
+	return nil
+}
+
+// sqliteBody stores text bodies as TEXT, so SQLite's JSON functions work on
+// them, and anything else as a BLOB
+func sqliteBody(body []byte) interface{} {
+	if utf8.Valid(body) {
+		return string(body)
+	}
+	return body
+}
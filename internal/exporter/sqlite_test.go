@@ -0,0 +1,165 @@
+package exporter
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+func writeSQLite(t *testing.T, cfg *config.Config, deliveries ...rabbitmq.Delivery) {
+	t.Helper()
+	exporter, err := NewExporter(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	if _, ok := exporter.(*SQLiteExporter); !ok {
+		t.Fatalf("Expected a SQLite exporter for the sqlite writer, got %T", exporter)
+	}
+
+	for _, d := range deliveries {
+		if err := exporter.WriteMessage(d); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("Failed to close exporter: %v", err)
+	}
+}
+
+func countRows(t *testing.T, path string) int {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM messages").Scan(&count); err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	return count
+}
+
+func TestSQLiteExporter_WriteMessage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.db")
+	cfg := &config.Config{Writer: config.SQLiteExporterKind, OutputFile: path}
+
+	var msg rabbitmq.Delivery
+	msg.Exchange = "orders"
+	msg.RoutingKey = "orders.created"
+	msg.Timestamp = time.Unix(1700000000, 0)
+	msg.ContentType = "application/json"
+	msg.Headers = amqp091.Table{"x-tenant": "acme"}
+	msg.Body = []byte(`{"id": 7}`)
+
+	var binary rabbitmq.Delivery
+	binary.RoutingKey = "blobs"
+	binary.Body = []byte{0xff, 0x00, 0xfe}
+
+	writeSQLite(t, cfg, msg, binary)
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var exchange, routingKey, tenant, contentType string
+	var timestamp int64
+	var id int
+	err = db.QueryRow(`SELECT exchange, routing_key, timestamp,
+		json_extract(headers, '$."x-tenant"'),
+		json_extract(properties, '$.contentType'),
+		json_extract(body, '$.id')
+		FROM messages WHERE routing_key = 'orders.created'`).Scan(&exchange, &routingKey, &timestamp, &tenant, &contentType, &id)
+	if err != nil {
+		t.Fatalf("Failed to query message: %v", err)
+	}
+	if exchange != "orders" || routingKey != "orders.created" || timestamp != 1700000000 || tenant != "acme" || contentType != "application/json" || id != 7 {
+		t.Errorf("Unexpected row: %s %s %d %s %s %d", exchange, routingKey, timestamp, tenant, contentType, id)
+	}
+
+	var body []byte
+	var headers sql.NullString
+	var ts sql.NullInt64
+	if err := db.QueryRow(`SELECT body, headers, timestamp FROM messages WHERE routing_key = 'blobs'`).Scan(&body, &headers, &ts); err != nil {
+		t.Fatalf("Failed to query binary message: %v", err)
+	}
+	if string(body) != string(binary.Body) {
+		t.Errorf("Expected binary body to be stored as is, got %x", body)
+	}
+	if headers.Valid || ts.Valid {
+		t.Error("Expected NULL headers and timestamp for a message without them")
+	}
+}
+
+func TestSQLiteExporter_FileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.db")
+	var msg rabbitmq.Delivery
+	msg.RoutingKey = "key"
+
+	writeSQLite(t, &config.Config{Writer: config.SQLiteExporterKind, OutputFile: path}, msg, msg)
+	writeSQLite(t, &config.Config{Writer: config.SQLiteExporterKind, OutputFile: path, FileMode: "append"}, msg)
+	if count := countRows(t, path); count != 3 {
+		t.Errorf("Expected append mode to keep existing rows, got %d rows", count)
+	}
+
+	writeSQLite(t, &config.Config{Writer: config.SQLiteExporterKind, OutputFile: path, FileMode: "overwrite"}, msg)
+	if count := countRows(t, path); count != 1 {
+		t.Errorf("Expected overwrite mode to start a new database, got %d rows", count)
+	}
+
+	if _, err := NewSQLiteExporter(&config.Config{OutputFile: path, FileMode: "invalid"}); err == nil {
+		t.Error("Expected error for invalid file mode")
+	}
+	if _, err := NewSQLiteExporter(&config.Config{}); err == nil {
+		t.Error("Expected error without an output file")
+	}
+}
+
+func TestSQLiteExporter_Batches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.db")
+	var msg rabbitmq.Delivery
+	msg.RoutingKey = "key"
+
+	deliveries := make([]rabbitmq.Delivery, sqliteBatchSize+10)
+	for i := range deliveries {
+		deliveries[i] = msg
+	}
+	writeSQLite(t, &config.Config{Writer: config.SQLiteExporterKind, OutputFile: path}, deliveries...)
+
+	if count := countRows(t, path); count != len(deliveries) {
+		t.Errorf("Expected %d rows across batches, got %d", len(deliveries), count)
+	}
+}
+
+func TestSQLiteExporter_CommitsQuietBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.db")
+	exporter, err := NewSQLiteExporter(&config.Config{Writer: config.SQLiteExporterKind, OutputFile: path})
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	defer exporter.Close()
+	exporter.interval = 50 * time.Millisecond
+
+	var msg rabbitmq.Delivery
+	msg.RoutingKey = "key"
+	if err := exporter.WriteMessage(msg); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+
+	// No further message arrives, the batch is committed by its timer
+	deadline := time.Now().Add(5 * time.Second)
+	for countRows(t, path) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the row to be committed without another message or Close")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,224 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/marianozunino/goq/internal/model"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+// Output formats accepted by --format, a template is given as
+// template=<text>
+const (
+	FormatJSON     = "json"
+	FormatTemplate = "template"
+)
+
+// TemplateMessage is what output templates render: the exported message
+// with its AMQP properties, the timestamp as a time and the body decoded
+// from JSON when it is JSON, so {{.Body.orderId}} works. With --transform
+// the template renders once per emitted value, found in Transformed, so
+// {{.RoutingKey}} {{.Transformed.sku}} still sees the message.
+type TemplateMessage struct {
+	Headers      map[string]interface{}
+	Exchange     string
+	RoutingKey   string
+	Timestamp    time.Time
+	Properties   *model.Properties
+	BodyEncoding string
+	Body         interface{}
+	RawBody      string
+	Transformed  interface{}
+}
+
+// newTemplate parses the output template of cfg. It returns nil when
+// messages are exported as JSON. Colour helpers only colour when colors is
+// set, so files get plain text.
+func newTemplate(cfg *config.Config, colors bool) (*template.Template, error) {
+	text, err := templateText(cfg)
+	if err != nil || text == "" {
+		return nil, err
+	}
+
+	tmpl, err := template.New("output").Funcs(templateFuncs(colors)).Parse(text)
+	if err != nil {
+		return nil, &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  fmt.Errorf("invalid output template: %v", err),
+		}
+	}
+	return tmpl, nil
+}
+
+// templateText returns the template of --format template=... or
+// --template-file
+func templateText(cfg *config.Config) (string, error) {
+	format, inline, _ := strings.Cut(cfg.Format, "=")
+
+	switch {
+	case cfg.Format == "" || cfg.Format == FormatJSON:
+		if cfg.TemplateFile == "" {
+			return "", nil
+		}
+	case format == FormatTemplate:
+		if cfg.TemplateFile != "" && inline != "" {
+			return "", &ExporterError{
+				Type: ErrorTypeConfiguration,
+				Err:  fmt.Errorf("use either --format template=... or --template-file, not both"),
+			}
+		}
+		if inline != "" {
+			return inline, nil
+		}
+		if cfg.TemplateFile == "" {
+			return "", &ExporterError{
+				Type: ErrorTypeConfiguration,
+				Err:  fmt.Errorf("--format template needs a template, e.g. --format 'template={{.RoutingKey}}'"),
+			}
+		}
+	default:
+		return "", &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  fmt.Errorf("invalid format: %s (use %s or %s=<text>)", cfg.Format, FormatJSON, FormatTemplate),
+		}
+	}
+
+	text, err := os.ReadFile(cfg.TemplateFile)
+	if err != nil {
+		return "", &ExporterError{
+			Type: ErrorTypeConfiguration,
+			Err:  fmt.Errorf("failed to read template file: %v", err),
+		}
+	}
+	return string(text), nil
+}
+
+// renderTemplate renders a record, adding the trailing newline the template
+// does not end with
+func renderTemplate(tmpl *template.Template, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, &ExporterError{
+			Type: ErrorTypeTransform,
+			Err:  fmt.Errorf("failed to render template: %v", err),
+		}
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// newTemplateMessage builds the template view of a delivery
+func newTemplateMessage(msg rabbitmq.Delivery) *TemplateMessage {
+	message := newMessage(msg, true)
+
+	data := &TemplateMessage{
+		Headers:    message.Headers,
+		Exchange:   message.Exchange,
+		RoutingKey: message.RoutingKey,
+		Timestamp:  msg.Timestamp,
+		Properties: message.Properties,
+		RawBody:    string(msg.Body),
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(msg.Body))
+	dec.UseNumber()
+	var body interface{}
+	switch {
+	case json.Valid(msg.Body) && dec.Decode(&body) == nil:
+		data.Body = body
+	case utf8.Valid(msg.Body):
+		data.Body = string(msg.Body)
+	default:
+		data.BodyEncoding = model.BodyEncodingBase64
+		data.Body = base64.StdEncoding.EncodeToString(msg.Body)
+	}
+
+	return data
+}
+
+// templateFuncs are the helpers available to output templates
+func templateFuncs(colors bool) template.FuncMap {
+	colorFunc := func(attrs ...color.Attribute) func(v interface{}) string {
+		c := color.New(attrs...)
+		if !colors {
+			c.DisableColor()
+		}
+		return func(v interface{}) string {
+			return c.Sprint(v)
+		}
+	}
+
+	return template.FuncMap{
+		"red":     colorFunc(color.FgRed),
+		"green":   colorFunc(color.FgGreen),
+		"yellow":  colorFunc(color.FgYellow),
+		"blue":    colorFunc(color.FgBlue),
+		"magenta": colorFunc(color.FgMagenta),
+		"cyan":    colorFunc(color.FgCyan),
+		"bold":    colorFunc(color.Bold),
+		"json": func(v interface{}) (string, error) {
+			encoded, err := json.Marshal(v)
+			return string(encoded), err
+		},
+		"prettyjson": func(v interface{}) (string, error) {
+			encoded, err := json.MarshalIndent(v, "", "  ")
+			return string(encoded), err
+		},
+		"truncate":   truncate,
+		"formatTime": formatTime,
+	}
+}
+
+// truncate shortens text to n characters, ending with an ellipsis when cut.
+// It takes the text last so it can be piped: {{.RawBody | truncate 80}}
+func truncate(n int, v interface{}) string {
+	s := fmt.Sprint(v)
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	if n == 1 {
+		return string(runes[:1])
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// formatTime formats a time, or a Unix timestamp in seconds, with a Go
+// layout: {{.Timestamp | formatTime "15:04:05"}}
+func formatTime(layout string, v interface{}) (string, error) {
+	var t time.Time
+	switch val := v.(type) {
+	case time.Time:
+		t = val
+	case int64:
+		t = time.Unix(val, 0)
+	case int:
+		t = time.Unix(int64(val), 0)
+	case float64:
+		t = time.Unix(int64(val), 0)
+	case json.Number:
+		seconds, err := val.Int64()
+		if err != nil {
+			return "", fmt.Errorf("formatTime: %v", err)
+		}
+		t = time.Unix(seconds, 0)
+	default:
+		return "", fmt.Errorf("formatTime: cannot format %T", v)
+	}
+	if t.IsZero() {
+		return "", nil
+	}
+	return t.Format(layout), nil
+}
@@ -0,0 +1,167 @@
+package exporter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/marianozunino/goq/internal/filter"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+func templateDelivery() rabbitmq.Delivery {
+	var msg rabbitmq.Delivery
+	msg.Exchange = "orders"
+	msg.RoutingKey = "orders.created"
+	msg.Timestamp = time.Date(2024, 3, 9, 14, 5, 7, 0, time.UTC)
+	msg.Headers = amqp091.Table{"x-tenant": "acme"}
+	msg.MessageId = "m-1"
+	msg.Body = []byte(`{"orderId": 12345678901, "note": "a rather long note"}`)
+	return msg
+}
+
+func TestWriteMessageCommon_Template(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{
+			name:     "fields and body",
+			format:   `template={{.Timestamp | formatTime "15:04:05"}} {{.RoutingKey}} {{.Body.orderId}}`,
+			expected: "14:05:07 orders.created 12345678901\n",
+		},
+		{
+			name:     "properties and headers",
+			format:   `template={{.Properties.MessageID}} {{index .Headers "x-tenant"}}`,
+			expected: "m-1 acme\n",
+		},
+		{
+			name:     "helpers",
+			format:   `template={{.Body.note | truncate 8}} {{json .Headers}} {{red .Exchange}}`,
+			expected: "a rathe… {\"x-tenant\":\"acme\"} orders\n",
+		},
+		{
+			name:     "trailing newline kept",
+			format:   "template={{.Exchange}}\n",
+			expected: "orders\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Format: tt.format}
+			tmpl, err := newTemplate(cfg, false)
+			if err != nil {
+				t.Fatalf("Failed to parse template: %v", err)
+			}
+
+			output, err := writeMessageCommon(templateDelivery(), cfg, nil, tmpl)
+			if err != nil {
+				t.Fatalf("Failed to render message: %v", err)
+			}
+			if string(output) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestWriteMessageCommon_TemplateWithTransform(t *testing.T) {
+	cfg := &config.Config{Format: `template={{.Timestamp | formatTime "15:04:05"}} {{.RoutingKey}} {{.Body.orderId}} {{.Transformed.sku}}`}
+	cfg.FilterConfig.Transform = ".body.items[]"
+	tmpl, err := newTemplate(cfg, false)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+
+	msg := templateDelivery()
+	msg.Body = []byte(`{"orderId": 7, "items": [{"sku": "a"}, {"sku": "b"}]}`)
+
+	output, err := writeMessageCommon(msg, cfg, filter.NewMessageFilter(cfg), tmpl)
+	if err != nil {
+		t.Fatalf("Failed to render message: %v", err)
+	}
+	expected := "14:05:07 orders.created 7 a\n14:05:07 orders.created 7 b\n"
+	if string(output) != expected {
+		t.Errorf("Expected the message fields next to each transformed record, got %q", output)
+	}
+}
+
+func TestNewTemplate(t *testing.T) {
+	templateFile := filepath.Join(t.TempDir(), "line.tmpl")
+	if err := os.WriteFile(templateFile, []byte("{{.RoutingKey}}"), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	for _, cfg := range []*config.Config{{}, {Format: "json"}} {
+		if tmpl, err := newTemplate(cfg, false); err != nil || tmpl != nil {
+			t.Errorf("Expected JSON output for format %q, got %v, %v", cfg.Format, tmpl, err)
+		}
+	}
+
+	for _, cfg := range []*config.Config{{TemplateFile: templateFile}, {Format: "template", TemplateFile: templateFile}} {
+		if tmpl, err := newTemplate(cfg, false); err != nil || tmpl == nil {
+			t.Errorf("Expected the template file to be used, got %v, %v", tmpl, err)
+		}
+	}
+
+	invalid := []struct {
+		name string
+		cfg  *config.Config
+		err  string
+	}{
+		{name: "unknown format", cfg: &config.Config{Format: "yaml"}, err: "invalid format"},
+		{name: "template without text", cfg: &config.Config{Format: "template"}, err: "needs a template"},
+		{name: "both", cfg: &config.Config{Format: "template={{.Exchange}}", TemplateFile: templateFile}, err: "not both"},
+		{name: "missing file", cfg: &config.Config{TemplateFile: filepath.Join(t.TempDir(), "missing.tmpl")}, err: "failed to read"},
+		{name: "parse error", cfg: &config.Config{Format: "template={{.Exchange"}, err: "invalid output template"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTemplate(tt.cfg, false)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestFileExporter_Template(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	exporter, err := NewFileWriter(&config.Config{OutputFile: path, Format: "template={{green .RoutingKey}}"})
+	if err != nil {
+		t.Fatalf("Failed to create file writer: %v", err)
+	}
+	if err := exporter.WriteMessage(templateDelivery()); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	exporter.Close()
+
+	content, _ := os.ReadFile(path)
+	if string(content) != "orders.created\n" {
+		t.Errorf("Expected plain text without colour codes, got %q", content)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		n        int
+		s        string
+		expected string
+	}{
+		{5, "short", "short"},
+		{4, "longer", "lon…"},
+		{3, "héllo", "hé…"},
+		{0, "unchanged", "unchanged"},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.n, tt.s); got != tt.expected {
+			t.Errorf("truncate(%d, %q): expected %q, got %q", tt.n, tt.s, tt.expected, got)
+		}
+	}
+}
@@ -9,14 +9,54 @@ import (
 
 	"github.com/itchyny/gojq"
 	"github.com/marianozunino/goq/internal/config"
+	"github.com/marianozunino/goq/internal/model"
 )
 
+// Document is the input of the jq filter, the header filters and the
+// routing key regex, serialized as:
+//
+//	{
+//	  "headers":     {"x-tenant": "acme"},
+//	  "properties":  {"contentType": "application/json", ...},
+//	  "routingKey":  "orders.created",
+//	  "exchange":    "orders",
+//	  "redelivered": false,
+//	  "body":        {...}
+//	}
+//
+// The body is the parsed JSON payload, or the payload as a string when it is
+// not JSON. Properties use the same field names as the --full-message output.
+// The jq filter addresses fields as .body.user or .headers["x-tenant"].
+//
+// The regex filter, the include and exclude patterns and the maximum size
+// do not see the document: they match and measure the raw message payload,
+// as they did before the document existed, so a pattern never matches a
+// header or property by accident.
+type Document struct {
+	Headers     map[string]interface{} `json:"headers"`
+	Properties  model.Properties       `json:"properties"`
+	RoutingKey  string                 `json:"routingKey"`
+	Exchange    string                 `json:"exchange"`
+	Redelivered bool                   `json:"redelivered"`
+	Body        interface{}            `json:"body"`
+}
+
+// headerFilter matches a header by name, and by value when one is given
+type headerFilter struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
 type MessageFilter struct {
 	maxMessageSize    int
 	includePatterns   []*regexp.Regexp
 	excludePatterns   []*regexp.Regexp
 	jsonFilter        *gojq.Query
 	regexFilter       *regexp.Regexp
+	headerFilters     []headerFilter
+	routingKeyRegex   *regexp.Regexp
+	transform         *gojq.Query
 	compilationErrors []error
 	mu                sync.RWMutex
 }
@@ -76,11 +116,43 @@ func (f *MessageFilter) compilePatterns(cfg *config.Config) {
 			f.regexFilter = regex
 		}
 	}
+
+	// Parse header filters, given as name=value or just name
+	f.headerFilters = make([]headerFilter, 0, len(cfg.FilterConfig.HeaderFilters))
+	for _, header := range cfg.FilterConfig.HeaderFilters {
+		name, value, hasValue := strings.Cut(header, "=")
+		if name == "" {
+			f.compilationErrors = append(f.compilationErrors, fmt.Errorf("invalid header filter %q: missing header name", header))
+			continue
+		}
+		f.headerFilters = append(f.headerFilters, headerFilter{name: name, value: value, hasValue: hasValue})
+	}
+
+	// Compile routing key regex
+	if cfg.FilterConfig.RoutingKeyRegex != "" {
+		if regex, err := regexp.Compile(cfg.FilterConfig.RoutingKeyRegex); err != nil {
+			f.compilationErrors = append(f.compilationErrors, fmt.Errorf("invalid routing key regex: %v", err))
+		} else {
+			f.routingKeyRegex = regex
+		}
+	}
+
+	// Compile transform
+	if cfg.FilterConfig.Transform != "" {
+		query, err := gojq.Parse(cfg.FilterConfig.Transform)
+		if err != nil {
+			f.compilationErrors = append(f.compilationErrors, fmt.Errorf("invalid transform: %v", err))
+		} else {
+			f.transform = query
+		}
+	}
 }
 
-// MessageDelivery represents a message that can be filtered
+// MessageDelivery represents a message that can be filtered. GetBody returns
+// the serialized filter input Document, GetPayload the message body.
 type MessageDelivery interface {
 	GetBody() []byte
+	GetPayload() []byte
 }
 
 func (f *MessageFilter) Filter(msg MessageDelivery) bool {
@@ -88,11 +160,11 @@ func (f *MessageFilter) Filter(msg MessageDelivery) bool {
 	defer f.mu.RUnlock()
 
 	// Size filter
-	if f.maxMessageSize > 0 && len(msg.GetBody()) > f.maxMessageSize {
+	if f.maxMessageSize > 0 && len(msg.GetPayload()) > f.maxMessageSize {
 		return false
 	}
 
-	body := string(msg.GetBody())
+	body := string(msg.GetPayload())
 
 	// Regex filter
 	if f.regexFilter != nil && !f.regexFilter.MatchString(body) {
@@ -111,14 +183,58 @@ func (f *MessageFilter) Filter(msg MessageDelivery) bool {
 		return false
 	}
 
+	if len(f.headerFilters) == 0 && f.routingKeyRegex == nil && f.jsonFilter == nil {
+		return true
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(msg.GetBody(), &data); err != nil {
+		return false
+	}
+	doc, _ := data.(map[string]interface{})
+
+	// Header filters
+	if !f.matchHeaders(doc) {
+		return false
+	}
+
+	// Routing key regex
+	if f.routingKeyRegex != nil {
+		routingKey, _ := doc["routingKey"].(string)
+		if !f.routingKeyRegex.MatchString(routingKey) {
+			return false
+		}
+	}
+
 	// JSON filter
 	if f.jsonFilter != nil {
-		return f.matchJSONFilter(msg.GetBody())
+		return f.matchJSONFilter(data)
 	}
 
 	return true
 }
 
+// matchHeaders reports whether the document carries every filtered header.
+// Values are compared in their string form, so x-retries=3 matches the
+// integer header 3.
+func (f *MessageFilter) matchHeaders(doc map[string]interface{}) bool {
+	if len(f.headerFilters) == 0 {
+		return true
+	}
+
+	headers, _ := doc["headers"].(map[string]interface{})
+	for _, header := range f.headerFilters {
+		value, ok := headers[header.name]
+		if !ok {
+			return false
+		}
+		if header.hasValue && fmt.Sprint(value) != header.value {
+			return false
+		}
+	}
+	return true
+}
+
 func (f *MessageFilter) matchAnyRegex(patterns []*regexp.Regexp, body string) bool {
 	for _, pattern := range patterns {
 		if pattern.MatchString(body) {
@@ -128,12 +244,7 @@ func (f *MessageFilter) matchAnyRegex(patterns []*regexp.Regexp, body string) bo
 	return false
 }
 
-func (f *MessageFilter) matchJSONFilter(body []byte) bool {
-	var data interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return false
-	}
-
+func (f *MessageFilter) matchJSONFilter(data interface{}) bool {
 	iter := f.jsonFilter.Run(data)
 	for {
 		v, ok := iter.Next()
@@ -154,6 +265,39 @@ func (f *MessageFilter) matchJSONFilter(body []byte) bool {
 	return false
 }
 
+// HasTransform reports whether a transform expression is configured
+func (f *MessageFilter) HasTransform() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.transform != nil
+}
+
+// Transform runs the transform expression against an exported record and
+// returns every value it emits, so a single record may become zero, one or
+// several records. Without a transform the record is returned unchanged.
+func (f *MessageFilter) Transform(record interface{}) ([]interface{}, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.transform == nil {
+		return []interface{}{record}, nil
+	}
+
+	var results []interface{}
+	iter := f.transform.Run(record)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, isErr := v.(error); isErr {
+			return nil, fmt.Errorf("transform failed: %v", err)
+		}
+		results = append(results, v)
+	}
+	return results, nil
+}
+
 // GetCompilationErrors returns any errors encountered during pattern compilation
 func (f *MessageFilter) GetCompilationErrors() []error {
 	f.mu.RLock()
@@ -6,15 +6,24 @@ import (
 	"github.com/marianozunino/goq/internal/config"
 )
 
-// testMessage implements MessageDelivery interface for testing
+// testMessage implements MessageDelivery interface for testing. The
+// payload defaults to the body when not set.
 type testMessage struct {
-	body []byte
+	body    []byte
+	payload []byte
 }
 
 func (t *testMessage) GetBody() []byte {
 	return t.body
 }
 
+func (t *testMessage) GetPayload() []byte {
+	if t.payload == nil {
+		return t.body
+	}
+	return t.payload
+}
+
 func TestMessageFilter_NoFilters(t *testing.T) {
 	cfg := &config.Config{}
 	filter := NewMessageFilter(cfg)
@@ -31,13 +40,7 @@ func TestMessageFilter_NoFilters(t *testing.T) {
 
 func TestMessageFilter_IncludePattern(t *testing.T) {
 	cfg := &config.Config{
-		FilterConfig: struct {
-			IncludePatterns []string
-			ExcludePatterns []string
-			JSONFilter      string
-			MaxMessageSize  int
-			RegexFilter     string
-		}{
+		FilterConfig: config.FilterConfig{
 			IncludePatterns: []string{"admin"},
 			ExcludePatterns: []string{},
 			JSONFilter:      "",
@@ -66,13 +69,7 @@ func TestMessageFilter_IncludePattern(t *testing.T) {
 
 func TestMessageFilter_ExcludePattern(t *testing.T) {
 	cfg := &config.Config{
-		FilterConfig: struct {
-			IncludePatterns []string
-			ExcludePatterns []string
-			JSONFilter      string
-			MaxMessageSize  int
-			RegexFilter     string
-		}{
+		FilterConfig: config.FilterConfig{
 			IncludePatterns: []string{},
 			ExcludePatterns: []string{"error"},
 			JSONFilter:      "",
@@ -101,13 +98,7 @@ func TestMessageFilter_ExcludePattern(t *testing.T) {
 
 func TestMessageFilter_JSONFilter(t *testing.T) {
 	cfg := &config.Config{
-		FilterConfig: struct {
-			IncludePatterns []string
-			ExcludePatterns []string
-			JSONFilter      string
-			MaxMessageSize  int
-			RegexFilter     string
-		}{
+		FilterConfig: config.FilterConfig{
 			IncludePatterns: []string{},
 			ExcludePatterns: []string{},
 			JSONFilter:      `.user.role == "admin"`,
@@ -136,13 +127,7 @@ func TestMessageFilter_JSONFilter(t *testing.T) {
 
 func TestMessageFilter_MaxMessageSize(t *testing.T) {
 	cfg := &config.Config{
-		FilterConfig: struct {
-			IncludePatterns []string
-			ExcludePatterns []string
-			JSONFilter      string
-			MaxMessageSize  int
-			RegexFilter     string
-		}{
+		FilterConfig: config.FilterConfig{
 			IncludePatterns: []string{},
 			ExcludePatterns: []string{},
 			JSONFilter:      "",
@@ -171,13 +156,7 @@ func TestMessageFilter_MaxMessageSize(t *testing.T) {
 
 func TestMessageFilter_InvalidRegexPattern(t *testing.T) {
 	cfg := &config.Config{
-		FilterConfig: struct {
-			IncludePatterns []string
-			ExcludePatterns []string
-			JSONFilter      string
-			MaxMessageSize  int
-			RegexFilter     string
-		}{
+		FilterConfig: config.FilterConfig{
 			IncludePatterns: []string{"[invalid"},
 			ExcludePatterns: []string{},
 			JSONFilter:      "",
@@ -205,13 +184,7 @@ func TestMessageFilter_InvalidRegexPattern(t *testing.T) {
 
 func TestMessageFilter_InvalidJSONFilter(t *testing.T) {
 	cfg := &config.Config{
-		FilterConfig: struct {
-			IncludePatterns []string
-			ExcludePatterns []string
-			JSONFilter      string
-			MaxMessageSize  int
-			RegexFilter     string
-		}{
+		FilterConfig: config.FilterConfig{
 			IncludePatterns: []string{},
 			ExcludePatterns: []string{},
 			JSONFilter:      "invalid jq syntax",
@@ -226,3 +199,179 @@ func TestMessageFilter_InvalidJSONFilter(t *testing.T) {
 		t.Error("Expected compilation errors for invalid JSON filter")
 	}
 }
+
+func TestMessageFilter_HeaderFilters(t *testing.T) {
+	cfg := &config.Config{
+		FilterConfig: config.FilterConfig{
+			MaxMessageSize: -1,
+			HeaderFilters:  []string{"x-tenant=acme", "x-retries=3", "x-trace"},
+		},
+	}
+
+	filter := NewMessageFilter(cfg)
+	if errs := filter.GetCompilationErrors(); len(errs) > 0 {
+		t.Fatalf("Unexpected compilation errors: %v", errs)
+	}
+
+	// Should pass - every header matches
+	msg1 := &testMessage{body: []byte(`{"headers": {"x-tenant": "acme", "x-retries": 3, "x-trace": "abc"}, "body": {}}`)}
+	if !filter.Filter(msg1) {
+		t.Error("Expected message with matching headers to pass header filter")
+	}
+
+	// Should fail - wrong header value
+	msg2 := &testMessage{body: []byte(`{"headers": {"x-tenant": "other", "x-retries": 3, "x-trace": "abc"}, "body": {}}`)}
+	if filter.Filter(msg2) {
+		t.Error("Expected message with other tenant to fail header filter")
+	}
+
+	// Should fail - missing header
+	msg3 := &testMessage{body: []byte(`{"headers": {"x-tenant": "acme", "x-retries": 3}, "body": {}}`)}
+	if filter.Filter(msg3) {
+		t.Error("Expected message without x-trace header to fail header filter")
+	}
+
+	// Should fail - no headers at all
+	msg4 := &testMessage{body: []byte(`{"headers": null, "body": {}}`)}
+	if filter.Filter(msg4) {
+		t.Error("Expected message without headers to fail header filter")
+	}
+}
+
+func TestMessageFilter_InvalidHeaderFilter(t *testing.T) {
+	cfg := &config.Config{
+		FilterConfig: config.FilterConfig{
+			MaxMessageSize: -1,
+			HeaderFilters:  []string{"=acme"},
+		},
+	}
+
+	filter := NewMessageFilter(cfg)
+	if errs := filter.GetCompilationErrors(); len(errs) == 0 {
+		t.Error("Expected compilation errors for header filter without a name")
+	}
+}
+
+func TestMessageFilter_RoutingKeyRegex(t *testing.T) {
+	cfg := &config.Config{
+		FilterConfig: config.FilterConfig{
+			MaxMessageSize:  -1,
+			RoutingKeyRegex: `^orders\.(created|updated)$`,
+		},
+	}
+
+	filter := NewMessageFilter(cfg)
+	if errs := filter.GetCompilationErrors(); len(errs) > 0 {
+		t.Fatalf("Unexpected compilation errors: %v", errs)
+	}
+
+	// Should pass - routing key matches
+	msg1 := &testMessage{body: []byte(`{"routingKey": "orders.created", "body": {}}`)}
+	if !filter.Filter(msg1) {
+		t.Error("Expected matching routing key to pass routing key filter")
+	}
+
+	// Should fail - routing key does not match, even though the body mentions it
+	msg2 := &testMessage{body: []byte(`{"routingKey": "orders.deleted", "body": {"note": "orders.created"}}`)}
+	if filter.Filter(msg2) {
+		t.Error("Expected other routing key to fail routing key filter")
+	}
+}
+
+func TestMessageFilter_JSONFilterOnDocument(t *testing.T) {
+	cfg := &config.Config{
+		FilterConfig: config.FilterConfig{
+			MaxMessageSize: -1,
+			JSONFilter:     `.properties.contentType == "application/json" and .redelivered == false and .headers["x-tenant"] == "acme"`,
+		},
+	}
+
+	filter := NewMessageFilter(cfg)
+	if errs := filter.GetCompilationErrors(); len(errs) > 0 {
+		t.Fatalf("Unexpected compilation errors: %v", errs)
+	}
+
+	msg1 := &testMessage{body: []byte(`{"headers": {"x-tenant": "acme"}, "properties": {"contentType": "application/json"}, "redelivered": false, "body": {}}`)}
+	if !filter.Filter(msg1) {
+		t.Error("Expected message to pass JSON filter over properties and headers")
+	}
+
+	msg2 := &testMessage{body: []byte(`{"headers": {"x-tenant": "acme"}, "properties": {"contentType": "text/plain"}, "redelivered": false, "body": {}}`)}
+	if filter.Filter(msg2) {
+		t.Error("Expected message with other content type to fail JSON filter")
+	}
+}
+
+func TestMessageFilter_TextFiltersSkipDocument(t *testing.T) {
+	body := []byte(`{"headers": {"x-tenant": "acme"}, "properties": {"contentType": "application/json"}, "routingKey": "orders.created", "body": {"id": 1}}`)
+	payload := []byte(`{"id": 1}`)
+
+	tests := []struct {
+		name     string
+		filter   config.FilterConfig
+		expected bool
+	}{
+		{name: "include header value", filter: config.FilterConfig{IncludePatterns: []string{"acme"}, MaxMessageSize: -1}, expected: false},
+		{name: "exclude property value", filter: config.FilterConfig{ExcludePatterns: []string{"application/json"}, MaxMessageSize: -1}, expected: true},
+		{name: "regex on routing key", filter: config.FilterConfig{RegexFilter: "orders", MaxMessageSize: -1}, expected: false},
+		{name: "regex on payload", filter: config.FilterConfig{RegexFilter: `"id": 1`, MaxMessageSize: -1}, expected: true},
+		{name: "size of payload", filter: config.FilterConfig{MaxMessageSize: len(payload)}, expected: true},
+		{name: "jq on document", filter: config.FilterConfig{JSONFilter: `.headers["x-tenant"] == "acme" and .body.id == 1`, MaxMessageSize: -1}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewMessageFilter(&config.Config{FilterConfig: tt.filter})
+			if errs := filter.GetCompilationErrors(); len(errs) > 0 {
+				t.Fatalf("Unexpected compilation errors: %v", errs)
+			}
+			if got := filter.Filter(&testMessage{body: body, payload: payload}); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMessageFilter_InvalidTransform(t *testing.T) {
+	cfg := &config.Config{
+		FilterConfig: config.FilterConfig{
+			MaxMessageSize: -1,
+			Transform:      ".body |",
+		},
+	}
+
+	filter := NewMessageFilter(cfg)
+	if errs := filter.GetCompilationErrors(); len(errs) == 0 {
+		t.Error("Expected compilation errors for invalid transform")
+	}
+}
+
+func TestMessageFilter_Transform(t *testing.T) {
+	cfg := &config.Config{
+		FilterConfig: config.FilterConfig{
+			MaxMessageSize: -1,
+			Transform:      ".body.ids[]",
+		},
+	}
+
+	filter := NewMessageFilter(cfg)
+	if !filter.HasTransform() {
+		t.Fatal("Expected transform to be configured")
+	}
+
+	record := map[string]interface{}{
+		"body": map[string]interface{}{"ids": []interface{}{1.0, 2.0}},
+	}
+	results, err := filter.Transform(record)
+	if err != nil {
+		t.Fatalf("Unexpected transform error: %v", err)
+	}
+
+	if len(results) != 2 || results[0] != 1.0 || results[1] != 2.0 {
+		t.Errorf("Expected every emitted value, got %v", results)
+	}
+
+	if _, err := filter.Transform(map[string]interface{}{"body": "text"}); err == nil {
+		t.Error("Expected runtime error when iterating a string")
+	}
+}
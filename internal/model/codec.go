@@ -0,0 +1,335 @@
+package model
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/linkedin/goavro/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec names accepted by --codec
+const (
+	CodecNone    = "none"
+	CodecMsgpack = "msgpack"
+	CodecCBOR    = "cbor"
+	CodecAvro    = "avro"
+)
+
+// Codec converts the bodies of a binary serialization format into their JSON
+// representation, so filters and exporters can work on them, and back for
+// replay
+type Codec interface {
+	Name() string
+	Decode(body []byte) ([]byte, error)
+	Encode(data []byte) ([]byte, error)
+}
+
+// CodecHeader is the header a dump records the codec of a decoded body in,
+// so replay encodes it back to the same format whatever --codec says then.
+// goq removes it before publishing.
+const CodecHeader = "x-goq-codec"
+
+// SchemaHeader is the header a dump records the writer schema of a decoded
+// body in, so replay encodes it with the same schema. goq removes it before
+// publishing.
+const SchemaHeader = "x-goq-schema"
+
+// SchemaCodec is a codec whose bodies name their writer schema, of which
+// several may be loaded
+type SchemaCodec interface {
+	Codec
+	// Schema returns the identifier of the writer schema of a body
+	Schema(body []byte) (string, error)
+	// EncodeSchema encodes with the schema Schema identified
+	EncodeSchema(data []byte, schema string) ([]byte, error)
+}
+
+// CodecRegistry selects the codec of a body from the AMQP content-type
+type CodecRegistry struct {
+	codecs       map[string]Codec
+	contentTypes map[string]string
+}
+
+// NewCodecRegistry returns a registry with the MessagePack and CBOR codecs,
+// plus Avro when schema files (.avsc) are given
+func NewCodecRegistry(avroSchemas []string) (*CodecRegistry, error) {
+	r := &CodecRegistry{
+		codecs:       map[string]Codec{},
+		contentTypes: map[string]string{},
+	}
+
+	r.Register(msgpackCodec{}, "application/msgpack", "application/x-msgpack", "application/vnd.msgpack")
+	r.Register(cborCodec{}, "application/cbor")
+
+	if len(avroSchemas) > 0 {
+		avro, err := newAvroCodec(avroSchemas)
+		if err != nil {
+			return nil, err
+		}
+		r.Register(avro, "avro/binary", "application/avro", "application/vnd.apache.avro+binary")
+	}
+
+	return r, nil
+}
+
+// Register adds a codec, selected for the given content types
+func (r *CodecRegistry) Register(codec Codec, contentTypes ...string) {
+	r.codecs[codec.Name()] = codec
+	for _, contentType := range contentTypes {
+		r.contentTypes[contentType] = codec.Name()
+	}
+}
+
+// Validate checks that a --codec value names a known codec
+func (r *CodecRegistry) Validate(name string) error {
+	if name == "" || name == CodecNone {
+		return nil
+	}
+	if _, ok := r.codecs[name]; ok {
+		return nil
+	}
+	if name == CodecAvro {
+		return fmt.Errorf("codec avro needs at least one schema (use --avro-schema)")
+	}
+
+	names := make([]string, 0, len(r.codecs))
+	for n := range r.codecs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown codec %q (use %s or %s)", name, strings.Join(names, ", "), CodecNone)
+}
+
+// Select returns the codec for a body: the override when set, otherwise the
+// one registered for the content-type. It returns nil when the body should
+// be left as is.
+func (r *CodecRegistry) Select(override, contentType string) Codec {
+	if override == CodecNone {
+		return nil
+	}
+	if override != "" {
+		return r.codecs[override]
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	return r.codecs[r.contentTypes[mediaType]]
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return CodecMsgpack }
+
+func (msgpackCodec) Decode(body []byte) ([]byte, error) {
+	var value interface{}
+	if err := msgpack.Unmarshal(body, &value); err != nil {
+		return nil, fmt.Errorf("invalid MessagePack body: %v", err)
+	}
+	return json.Marshal(jsonValue(value))
+}
+
+func (msgpackCodec) Encode(data []byte) ([]byte, error) {
+	value, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(value)
+}
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string { return CodecCBOR }
+
+func (cborCodec) Decode(body []byte) ([]byte, error) {
+	var value interface{}
+	if err := cbor.Unmarshal(body, &value); err != nil {
+		return nil, fmt.Errorf("invalid CBOR body: %v", err)
+	}
+	return json.Marshal(jsonValue(value))
+}
+
+func (cborCodec) Encode(data []byte) ([]byte, error) {
+	value, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(value)
+}
+
+// avroCodec handles Avro single-object encoding: every body starts with the
+// fingerprint of its writer schema, which picks one of the loaded schemas
+type avroCodec struct {
+	schemas []*goavro.Codec
+	byRabin map[uint64]*goavro.Codec
+}
+
+func newAvroCodec(paths []string) (*avroCodec, error) {
+	c := &avroCodec{byRabin: map[uint64]*goavro.Codec{}}
+	for _, path := range paths {
+		schema, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Avro schema: %v", err)
+		}
+		codec, err := goavro.NewCodec(string(schema))
+		if err != nil {
+			return nil, fmt.Errorf("invalid Avro schema %s: %v", path, err)
+		}
+		// The same schema given twice must not count as two matches
+		if _, ok := c.byRabin[codec.Rabin]; ok {
+			continue
+		}
+		c.schemas = append(c.schemas, codec)
+		c.byRabin[codec.Rabin] = codec
+	}
+	return c, nil
+}
+
+func (c *avroCodec) Name() string { return CodecAvro }
+
+func (c *avroCodec) Decode(body []byte) ([]byte, error) {
+	fingerprint, _, err := goavro.FingerprintFromSOE(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro body: %v", err)
+	}
+	codec, ok := c.byRabin[fingerprint]
+	if !ok {
+		return nil, fmt.Errorf("no Avro schema loaded for fingerprint %x", fingerprint)
+	}
+
+	native, _, err := codec.NativeFromSingle(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro body: %v", err)
+	}
+	return codec.TextualFromNative(nil, native)
+}
+
+// Schema returns the fingerprint of the writer schema of a body, in hex
+func (c *avroCodec) Schema(body []byte) (string, error) {
+	fingerprint, _, err := goavro.FingerprintFromSOE(body)
+	if err != nil {
+		return "", fmt.Errorf("invalid Avro body: %v", err)
+	}
+	return strconv.FormatUint(fingerprint, 16), nil
+}
+
+// EncodeSchema writes the record with the schema of the given fingerprint
+func (c *avroCodec) EncodeSchema(data []byte, schema string) ([]byte, error) {
+	fingerprint, err := strconv.ParseUint(schema, 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro schema fingerprint %q", schema)
+	}
+	codec, ok := c.byRabin[fingerprint]
+	if !ok {
+		return nil, fmt.Errorf("no Avro schema loaded for fingerprint %x", fingerprint)
+	}
+	native, _, err := codec.NativeFromTextual(data)
+	if err != nil {
+		return nil, fmt.Errorf("body does not match Avro schema %s: %v", codec.Schema(), err)
+	}
+	return codec.SingleFromNative(nil, native)
+}
+
+// Encode writes the record with the only schema it is valid for. The JSON
+// form does not say which schema it was read with, so a record that several
+// schemas accept is refused rather than written with a guessed fingerprint.
+func (c *avroCodec) Encode(data []byte) ([]byte, error) {
+	var matched []*goavro.Codec
+	var natives []interface{}
+	var lastErr error
+	for _, codec := range c.schemas {
+		native, _, err := codec.NativeFromTextual(data)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		matched = append(matched, codec)
+		natives = append(natives, native)
+	}
+
+	switch len(matched) {
+	case 0:
+		return nil, fmt.Errorf("body does not match any Avro schema: %v", lastErr)
+	case 1:
+		return matched[0].SingleFromNative(nil, natives[0])
+	default:
+		return nil, fmt.Errorf("body matches %d Avro schemas, dump it again to record its schema in the %s header", len(matched), SchemaHeader)
+	}
+}
+
+// jsonValue converts decoded values into types encoding/json can marshal:
+// maps get string keys and binary strings become base64
+func jsonValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[fmt.Sprint(k)] = jsonValue(item)
+		}
+		return m
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = jsonValue(item)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = jsonValue(item)
+		}
+		return val
+	case []byte:
+		if utf8.Valid(val) {
+			return string(val)
+		}
+		return base64.StdEncoding.EncodeToString(val)
+	default:
+		return val
+	}
+}
+
+// decodeJSON parses a JSON body keeping integers as integers, so they are
+// encoded back with an integer type
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("body is not JSON: %v", err)
+	}
+	return numbers(value), nil
+}
+
+func numbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = numbers(item)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = numbers(item)
+		}
+		return val
+	default:
+		return val
+	}
+}
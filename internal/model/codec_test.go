@@ -0,0 +1,263 @@
+package model
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const orderSchema = `{
+	"type": "record",
+	"name": "Order",
+	"namespace": "com.acme",
+	"fields": [
+		{"name": "id", "type": "string"},
+		{"name": "quantity", "type": "int"},
+		{"name": "note", "type": ["null", "string"], "default": null}
+	]
+}`
+
+func writeSchema(t *testing.T, schema string) string {
+	path := filepath.Join(t.TempDir(), "order.avsc")
+	if err := os.WriteFile(path, []byte(schema), 0o644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	return path
+}
+
+func assertJSONEqual(t *testing.T, expected string, actual []byte) {
+	t.Helper()
+	var want, got interface{}
+	if err := json.Unmarshal([]byte(expected), &want); err != nil {
+		t.Fatalf("Invalid expected JSON: %v", err)
+	}
+	if err := json.Unmarshal(actual, &got); err != nil {
+		t.Fatalf("Expected JSON, got %s", actual)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+}
+
+func TestCodecRegistry_Select(t *testing.T) {
+	registry, err := NewCodecRegistry(nil)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		override    string
+		contentType string
+		expected    string
+	}{
+		{name: "msgpack content type", contentType: "application/msgpack", expected: CodecMsgpack},
+		{name: "content type with parameters", contentType: "application/x-msgpack; charset=binary", expected: CodecMsgpack},
+		{name: "cbor content type", contentType: "application/cbor", expected: CodecCBOR},
+		{name: "json content type", contentType: "application/json", expected: ""},
+		{name: "no content type", expected: ""},
+		{name: "override", override: CodecCBOR, contentType: "application/msgpack", expected: CodecCBOR},
+		{name: "disabled", override: CodecNone, contentType: "application/msgpack", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec := registry.Select(tt.override, tt.contentType)
+			name := ""
+			if codec != nil {
+				name = codec.Name()
+			}
+			if name != tt.expected {
+				t.Errorf("Expected codec %q, got %q", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestCodecRegistry_Validate(t *testing.T) {
+	registry, err := NewCodecRegistry(nil)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+
+	for _, name := range []string{"", CodecNone, CodecMsgpack, CodecCBOR} {
+		if err := registry.Validate(name); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", name, err)
+		}
+	}
+
+	if err := registry.Validate(CodecAvro); err == nil {
+		t.Error("Expected avro to need a schema")
+	}
+
+	if err := registry.Validate("thrift"); err == nil {
+		t.Error("Expected unknown codec error")
+	}
+}
+
+func TestMsgpackCodec_RoundTrip(t *testing.T) {
+	body, err := msgpack.Marshal(map[string]interface{}{
+		"id":       "o-1",
+		"quantity": 3,
+		"tags":     []string{"a", "b"},
+		"nested":   map[string]interface{}{"ok": true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal msgpack: %v", err)
+	}
+
+	codec := msgpackCodec{}
+	decoded, err := codec.Decode(body)
+	if err != nil {
+		t.Fatalf("Failed to decode msgpack: %v", err)
+	}
+	assertJSONEqual(t, `{"id": "o-1", "quantity": 3, "tags": ["a", "b"], "nested": {"ok": true}}`, decoded)
+
+	encoded, err := codec.Encode(decoded)
+	if err != nil {
+		t.Fatalf("Failed to encode msgpack: %v", err)
+	}
+
+	var value map[string]interface{}
+	if err := msgpack.Unmarshal(encoded, &value); err != nil {
+		t.Fatalf("Failed to read encoded msgpack: %v", err)
+	}
+	if value["quantity"] != int64(3) {
+		t.Errorf("Expected quantity to be encoded as an integer, got %T", value["quantity"])
+	}
+
+	if _, err := codec.Decode([]byte{0xc1}); err == nil {
+		t.Error("Expected error for invalid msgpack")
+	}
+}
+
+func TestCBORCodec_RoundTrip(t *testing.T) {
+	body, err := cbor.Marshal(map[interface{}]interface{}{
+		"id":  "o-1",
+		1:     "integer key",
+		"raw": []byte{0xff, 0x00},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal cbor: %v", err)
+	}
+
+	codec := cborCodec{}
+	decoded, err := codec.Decode(body)
+	if err != nil {
+		t.Fatalf("Failed to decode cbor: %v", err)
+	}
+	assertJSONEqual(t, `{"id": "o-1", "1": "integer key", "raw": "/wA="}`, decoded)
+
+	encoded, err := codec.Encode([]byte(`{"id": "o-1", "quantity": 3}`))
+	if err != nil {
+		t.Fatalf("Failed to encode cbor: %v", err)
+	}
+
+	var value map[string]interface{}
+	if err := cbor.Unmarshal(encoded, &value); err != nil {
+		t.Fatalf("Failed to read encoded cbor: %v", err)
+	}
+	if value["quantity"] != uint64(3) {
+		t.Errorf("Expected quantity to be encoded as an integer, got %T", value["quantity"])
+	}
+}
+
+func TestAvroCodec_RoundTrip(t *testing.T) {
+	registry, err := NewCodecRegistry([]string{writeSchema(t, orderSchema)})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+
+	codec := registry.Select("", "avro/binary")
+	if codec == nil {
+		t.Fatal("Expected avro codec for avro/binary")
+	}
+
+	record := []byte(`{"id": "o-1", "quantity": 3, "note": {"string": "fragile"}}`)
+	encoded, err := codec.Encode(record)
+	if err != nil {
+		t.Fatalf("Failed to encode avro: %v", err)
+	}
+	if encoded[0] != 0xc3 || encoded[1] != 0x01 {
+		t.Errorf("Expected single-object encoding marker, got %x", encoded[:2])
+	}
+
+	decoded, err := codec.Decode(encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode avro: %v", err)
+	}
+	assertJSONEqual(t, string(record), decoded)
+
+	if _, err := codec.Encode([]byte(`{"unknown": true}`)); err == nil {
+		t.Error("Expected error for a record that matches no schema")
+	}
+}
+
+// shipmentSchema has the fields of orderSchema, so every order is also a
+// valid shipment
+const shipmentSchema = `{
+	"type": "record",
+	"name": "Shipment",
+	"namespace": "com.acme",
+	"fields": [
+		{"name": "id", "type": "string"},
+		{"name": "quantity", "type": "int"},
+		{"name": "note", "type": ["null", "string"], "default": null}
+	]
+}`
+
+func TestAvroCodec_OverlappingSchemas(t *testing.T) {
+	registry, err := NewCodecRegistry([]string{writeSchema(t, orderSchema), writeSchema(t, shipmentSchema)})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	codec, ok := registry.Select(CodecAvro, "").(SchemaCodec)
+	if !ok {
+		t.Fatal("Expected the avro codec to name the schema of its bodies")
+	}
+
+	record := []byte(`{"id": "o-1", "quantity": 3, "note": null}`)
+	if _, err := codec.Encode(record); err == nil {
+		t.Error("Expected a record several schemas accept to be refused without a schema")
+	}
+
+	shipments, err := NewCodecRegistry([]string{writeSchema(t, shipmentSchema)})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	published, err := shipments.Select(CodecAvro, "").Encode(record)
+	if err != nil {
+		t.Fatalf("Failed to encode avro: %v", err)
+	}
+
+	schema, err := codec.Schema(published)
+	if err != nil {
+		t.Fatalf("Failed to read the schema: %v", err)
+	}
+	encoded, err := codec.EncodeSchema(record, schema)
+	if err != nil {
+		t.Fatalf("Failed to encode with the recorded schema: %v", err)
+	}
+	if !reflect.DeepEqual(encoded, published) {
+		t.Errorf("Expected the body to be encoded with the shipment schema, got %x, want %x", encoded, published)
+	}
+
+	if _, err := codec.EncodeSchema(record, "ffff"); err == nil {
+		t.Error("Expected error for a schema that is not loaded")
+	}
+}
+
+func TestAvroCodec_InvalidSchema(t *testing.T) {
+	if _, err := NewCodecRegistry([]string{writeSchema(t, `{"type": "nope"}`)}); err == nil {
+		t.Error("Expected error for an invalid schema")
+	}
+
+	if _, err := NewCodecRegistry([]string{filepath.Join(t.TempDir(), "missing.avsc")}); err == nil {
+		t.Error("Expected error for a missing schema file")
+	}
+}
@@ -1,36 +1,82 @@
 package model
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Body encodings marking bodies that are not exported as JSON or text
+const (
+	BodyEncodingBase64 = "base64"
+	BodyEncodingHex    = "hex"
+)
 
 // Message represents a flexible message structure that can handle
-// both string and JSON body content
+// string, JSON and binary body content. Body always holds the payload
+// bytes: JSON payloads are exported as JSON, text as a string and anything
+// else (binary data, or a payload that is itself a JSON string) as base64
+// with BodyEncoding set.
 type Message struct {
-	Headers    map[string]interface{} `json:"headers"`
-	Exchange   string                 `json:"exchange"`
-	RoutingKey string                 `json:"routingKey"`
-	Body       json.RawMessage        `json:"body"`
+	Headers      map[string]interface{} `json:"headers"`
+	Exchange     string                 `json:"exchange"`
+	RoutingKey   string                 `json:"routingKey"`
+	Timestamp    int64                  `json:"timestamp"`
+	Properties   *Properties            `json:"properties,omitempty"`
+	BodyEncoding string                 `json:"bodyEncoding,omitempty"`
+	Body         json.RawMessage        `json:"body"`
+}
+
+// Properties holds the AMQP basic properties and delivery metadata
+// that are only exported in full-message mode
+type Properties struct {
+	ContentType     string `json:"contentType"`
+	ContentEncoding string `json:"contentEncoding"`
+	DeliveryMode    uint8  `json:"deliveryMode"`
+	Priority        uint8  `json:"priority"`
+	CorrelationID   string `json:"correlationId"`
+	ReplyTo         string `json:"replyTo"`
+	Expiration      string `json:"expiration"`
+	MessageID       string `json:"messageId"`
+	Type            string `json:"type"`
+	UserID          string `json:"userId"`
+	AppID           string `json:"appId"`
+	DeliveryTag     uint64 `json:"deliveryTag"`
+	Redelivered     bool   `json:"redelivered"`
+	ConsumerTag     string `json:"consumerTag"`
 }
 
-// MarshalJSON custom marshaler to handle string or JSON body
+// MarshalJSON custom marshaler to handle string, JSON or binary body
 func (m *Message) MarshalJSON() ([]byte, error) {
 	// Create a temporary struct for marshaling
 	msg := struct {
-		Headers    map[string]interface{} `json:"headers"`
-		Exchange   string                 `json:"exchange"`
-		RoutingKey string                 `json:"routingKey"`
-		Timestamp  int64                  `json:"timestamp"`
-		Body       any                    `json:"body"`
+		Headers      map[string]interface{} `json:"headers"`
+		Exchange     string                 `json:"exchange"`
+		RoutingKey   string                 `json:"routingKey"`
+		Timestamp    int64                  `json:"timestamp"`
+		Properties   *Properties            `json:"properties,omitempty"`
+		BodyEncoding string                 `json:"bodyEncoding,omitempty"`
+		Body         any                    `json:"body"`
 	}{
 		Headers:    m.Headers,
 		Exchange:   m.Exchange,
 		RoutingKey: m.RoutingKey,
+		Timestamp:  m.Timestamp,
+		Properties: m.Properties,
 	}
 
-	// Try to unmarshal the body to detect if it's JSON or a string
-	var bodyContent interface{}
-	if err := json.Unmarshal(m.Body, &bodyContent); err == nil {
-		msg.Body = bodyContent
-	} else {
+	switch {
+	case m.BodyEncoding != "" || !utf8.Valid(m.Body) || isJSONString(m.Body):
+		// Exported as a JSON string these payloads could not be told apart
+		// from text on the way back, or would lose bytes
+		msg.BodyEncoding = BodyEncodingBase64
+		msg.Body = base64.StdEncoding.EncodeToString(m.Body)
+	case json.Valid(m.Body):
+		msg.Body = json.RawMessage(m.Body)
+	default:
 		msg.Body = string(m.Body)
 	}
 
@@ -40,11 +86,13 @@ func (m *Message) MarshalJSON() ([]byte, error) {
 // UnmarshalJSON custom unmarshaler to detect body type
 func (m *Message) UnmarshalJSON(data []byte) error {
 	var temp struct {
-		Headers    map[string]interface{} `json:"headers"`
-		Exchange   string                 `json:"exchange"`
-		RoutingKey string                 `json:"routingKey"`
-		Timestamp  int64                  `json:"timestamp"`
-		Body       json.RawMessage        `json:"body"`
+		Headers      map[string]interface{} `json:"headers"`
+		Exchange     string                 `json:"exchange"`
+		RoutingKey   string                 `json:"routingKey"`
+		Timestamp    int64                  `json:"timestamp"`
+		Properties   *Properties            `json:"properties"`
+		BodyEncoding string                 `json:"bodyEncoding"`
+		Body         json.RawMessage        `json:"body"`
 	}
 
 	if err := json.Unmarshal(data, &temp); err != nil {
@@ -54,13 +102,67 @@ func (m *Message) UnmarshalJSON(data []byte) error {
 	m.Headers = temp.Headers
 	m.Exchange = temp.Exchange
 	m.RoutingKey = temp.RoutingKey
+	m.Timestamp = temp.Timestamp
+	m.Properties = temp.Properties
+	m.BodyEncoding = ""
+
+	if temp.BodyEncoding != "" {
+		body, err := decodeBody(temp.BodyEncoding, temp.Body)
+		if err != nil {
+			return err
+		}
+		m.BodyEncoding = BodyEncodingBase64
+		m.Body = body
+		return nil
+	}
 
-	var jsonCheck interface{}
-	if err := json.Unmarshal(temp.Body, &jsonCheck); err == nil {
-		m.Body = temp.Body
-	} else {
-		m.Body = temp.Body
+	// Text bodies are exported as JSON strings, unquote them back into the
+	// payload. Any other JSON value is the payload itself.
+	if isJSONString(temp.Body) {
+		var text string
+		if err := json.Unmarshal(temp.Body, &text); err != nil {
+			return err
+		}
+		m.Body = []byte(text)
+		return nil
 	}
 
+	m.Body = temp.Body
 	return nil
 }
+
+// RawBody returns the original payload bytes of the message, ready to be
+// published again
+func (m *Message) RawBody() ([]byte, error) {
+	return m.Body, nil
+}
+
+// isJSONString reports whether data is a JSON document holding a single string
+func isJSONString(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && trimmed[0] == '"' && json.Valid(trimmed)
+}
+
+// decodeBody turns an encoded body back into the original payload bytes
+func decodeBody(encoding string, body json.RawMessage) ([]byte, error) {
+	var encoded string
+	if err := json.Unmarshal(body, &encoded); err != nil {
+		return nil, fmt.Errorf("body with %s encoding must be a string: %v", encoding, err)
+	}
+
+	var decoded []byte
+	var err error
+	switch encoding {
+	case BodyEncodingBase64:
+		decoded, err = base64.StdEncoding.DecodeString(encoded)
+	case BodyEncodingHex:
+		decoded, err = hex.DecodeString(encoded)
+	default:
+		return nil, fmt.Errorf("unsupported body encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s body: %v", encoding, err)
+	}
+
+	return decoded, nil
+}
@@ -1,9 +1,12 @@
 package model
 
 import (
+	"bytes"
 	"encoding/json"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/quick"
 )
 
 func TestMessage_MarshalJSON(t *testing.T) {
@@ -271,3 +274,271 @@ func TestMessage_String(t *testing.T) {
 		t.Error("Expected routing key to be set correctly")
 	}
 }
+
+func TestMessage_MarshalJSON_WithProperties(t *testing.T) {
+	msg := &Message{
+		Exchange:   "test_exchange",
+		RoutingKey: "test.key",
+		Timestamp:  1700000000,
+		Properties: &Properties{
+			ContentType:     "application/json",
+			ContentEncoding: "utf-8",
+			DeliveryMode:    2,
+			Priority:        5,
+			CorrelationID:   "corr-1",
+			ReplyTo:         "reply.queue",
+			Expiration:      "60000",
+			MessageID:       "msg-1",
+			Type:            "order.created",
+			UserID:          "guest",
+			AppID:           "orders",
+			DeliveryTag:     42,
+			Redelivered:     true,
+			ConsumerTag:     "ctag-1",
+		},
+		Body: json.RawMessage(`{"test": "data"}`),
+	}
+
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal message with properties: %v", err)
+	}
+
+	var result Message
+	if err := json.Unmarshal(jsonData, &result); err != nil {
+		t.Fatalf("Failed to unmarshal message with properties: %v", err)
+	}
+
+	if result.Timestamp != msg.Timestamp {
+		t.Errorf("Expected timestamp %d, got %d", msg.Timestamp, result.Timestamp)
+	}
+
+	if result.Properties == nil {
+		t.Fatal("Expected properties to be present")
+	}
+
+	if *result.Properties != *msg.Properties {
+		t.Errorf("Expected properties %+v, got %+v", *msg.Properties, *result.Properties)
+	}
+}
+
+func TestMessage_MarshalJSON_WithoutProperties(t *testing.T) {
+	msg := &Message{
+		Exchange:   "test_exchange",
+		RoutingKey: "test.key",
+		Body:       json.RawMessage(`{"test": "data"}`),
+	}
+
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal message: %v", err)
+	}
+
+	if strings.Contains(string(jsonData), `"properties"`) {
+		t.Errorf("Expected properties to be omitted, got %s", jsonData)
+	}
+
+	var result Message
+	if err := json.Unmarshal(jsonData, &result); err != nil {
+		t.Fatalf("Failed to unmarshal message: %v", err)
+	}
+
+	if result.Properties != nil {
+		t.Error("Expected nil properties")
+	}
+}
+
+func TestMessage_RawBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		expected string
+	}{
+		{name: "JSON object", document: `{"body": {"test":"data"}}`, expected: `{"test":"data"}`},
+		{name: "string body", document: `{"body": "plain text"}`, expected: "plain text"},
+		{name: "escaped string body", document: `{"body": "line1\nline2"}`, expected: "line1\nline2"},
+		{name: "base64 body", document: `{"bodyEncoding": "base64", "body": "ImhpIg=="}`, expected: `"hi"`},
+		{name: "missing body", document: `{}`, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg Message
+			if err := json.Unmarshal([]byte(tt.document), &msg); err != nil {
+				t.Fatalf("Failed to unmarshal message: %v", err)
+			}
+			raw, err := msg.RawBody()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(raw) != tt.expected {
+				t.Errorf("Expected body %q, got %q", tt.expected, string(raw))
+			}
+		})
+	}
+}
+
+func TestMessage_RawBody_RoundTrip(t *testing.T) {
+	original := &Message{Body: []byte("not json at all")}
+
+	jsonData, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("Failed to marshal message: %v", err)
+	}
+
+	var result Message
+	if err := json.Unmarshal(jsonData, &result); err != nil {
+		t.Fatalf("Failed to unmarshal message: %v", err)
+	}
+
+	raw, err := result.RawBody()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(raw) != "not json at all" {
+		t.Errorf("Expected original body, got %q", string(raw))
+	}
+}
+
+func TestMessage_MarshalJSON_BinaryBodyEncoding(t *testing.T) {
+	msg := &Message{Body: []byte{0x0a, 0x03, 0xff, 0xfe, 0x00}}
+
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal binary message: %v", err)
+	}
+
+	if !strings.Contains(string(jsonData), `"bodyEncoding":"base64"`) {
+		t.Errorf("Expected base64 body encoding marker, got %s", jsonData)
+	}
+
+	if !strings.Contains(string(jsonData), `"body":"CgP//gA="`) {
+		t.Errorf("Expected base64 encoded body, got %s", jsonData)
+	}
+}
+
+func TestMessage_MarshalJSON_TextBodyHasNoEncoding(t *testing.T) {
+	msg := &Message{Body: []byte("héllo wörld")}
+
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal text message: %v", err)
+	}
+
+	if strings.Contains(string(jsonData), "bodyEncoding") {
+		t.Errorf("Expected no body encoding for UTF-8 text, got %s", jsonData)
+	}
+}
+
+func TestMessage_UnmarshalJSON_HexBody(t *testing.T) {
+	var msg Message
+	if err := json.Unmarshal([]byte(`{"bodyEncoding": "hex", "body": "cafe00"}`), &msg); err != nil {
+		t.Fatalf("Failed to unmarshal hex message: %v", err)
+	}
+
+	raw, err := msg.RawBody()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(raw, []byte{0xca, 0xfe, 0x00}) {
+		t.Errorf("Expected decoded hex body, got %x", raw)
+	}
+}
+
+func TestMessage_UnmarshalJSON_InvalidBodyEncoding(t *testing.T) {
+	inputs := []string{
+		`{"bodyEncoding": "rot13", "body": "abc"}`,
+		`{"bodyEncoding": "base64", "body": "not base64!"}`,
+		`{"bodyEncoding": "base64", "body": {"a": 1}}`,
+	}
+
+	for _, input := range inputs {
+		var msg Message
+		if err := json.Unmarshal([]byte(input), &msg); err == nil {
+			t.Errorf("Expected error for %s", input)
+		}
+	}
+}
+
+// TestMessage_RoundTrip_ArbitraryBytes checks that any payload survives an
+// export and re-import byte for byte
+func TestMessage_RoundTrip_ArbitraryBytes(t *testing.T) {
+	roundTrip := func(body []byte) bool {
+		original := &Message{Body: body}
+
+		jsonData, err := json.Marshal(original)
+		if err != nil {
+			t.Logf("marshal failed for %x: %v", body, err)
+			return false
+		}
+
+		var result Message
+		if err := json.Unmarshal(jsonData, &result); err != nil {
+			t.Logf("unmarshal failed for %x: %v", body, err)
+			return false
+		}
+
+		raw, err := result.RawBody()
+		if err != nil {
+			t.Logf("raw body failed for %x: %v", body, err)
+			return false
+		}
+
+		// Whitespace inside JSON bodies is not preserved, compare those
+		// semantically
+		if result.BodyEncoding == "" && json.Valid(body) {
+			var want, got interface{}
+			json.Unmarshal(body, &want)
+			json.Unmarshal(raw, &got)
+			return reflect.DeepEqual(want, got)
+		}
+
+		return bytes.Equal(raw, body)
+	}
+
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+
+	samples := [][]byte{
+		nil,
+		{},
+		{0x00},
+		{0xff, 0xfe, 0xfd},
+		[]byte(`"quoted"`),
+		[]byte("plain text"),
+		[]byte(`{"json": true}`),
+		{0x1f, 0x8b, 0x08, 0x00},
+	}
+	for _, sample := range samples {
+		if !roundTrip(sample) {
+			t.Errorf("Round trip failed for %x", sample)
+		}
+	}
+}
+
+// TestMessage_RoundTrip_Stable checks that re-exporting an imported message
+// produces the same document
+func TestMessage_RoundTrip_Stable(t *testing.T) {
+	stable := func(body []byte) bool {
+		first, err := json.Marshal(&Message{Body: body})
+		if err != nil {
+			return false
+		}
+
+		var msg Message
+		if err := json.Unmarshal(first, &msg); err != nil {
+			return false
+		}
+
+		second, err := json.Marshal(&msg)
+		if err != nil {
+			return false
+		}
+		return bytes.Equal(first, second)
+	}
+
+	if err := quick.Check(stable, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
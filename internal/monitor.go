@@ -1,12 +1,16 @@
 package app
 
-import "github.com/marianozunino/goq/internal/config"
+import (
+	"context"
+
+	"github.com/marianozunino/goq/internal/config"
+)
 
 // Monitor is a package-level function for convenience
-func Monitor(cfg *config.Config) error {
+func Monitor(ctx context.Context, cfg *config.Config) error {
 	processor, err := NewMessageProcessor(cfg)
 	if err != nil {
 		return err
 	}
-	return processor.Monitor()
+	return processor.Monitor(ctx)
 }
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/marianozunino/goq/internal/rmq"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+// Move shovels the messages of a queue that pass the filters to another
+// exchange or queue
+func Move(ctx context.Context, cfg *config.Config) error {
+	consumer, err := rmq.NewConsumer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create consumer: %v", err)
+	}
+	defer consumer.Close()
+
+	exchange := cfg.TargetExchange
+	if cfg.TargetQueue != "" {
+		exchange = ""
+	}
+
+	targetRoutingKey := func(d rabbitmq.Delivery) string {
+		switch {
+		case cfg.TargetQueue != "":
+			return cfg.TargetQueue
+		case cfg.TargetRoutingKey != "":
+			return cfg.TargetRoutingKey
+		default:
+			return d.RoutingKey
+		}
+	}
+
+	var forward func(context.Context, rabbitmq.Delivery) error
+	if cfg.DryRun {
+		yellow := color.New(color.FgYellow)
+		forward = func(_ context.Context, d rabbitmq.Delivery) error {
+			yellow.Printf("[dry-run] would move message (exchange: %q, routing key: %q, %d bytes) to exchange %q with routing key %q\n",
+				d.Exchange, d.RoutingKey, len(d.Body), exchange, targetRoutingKey(d))
+			return nil
+		}
+	} else {
+		publisher, err := rmq.NewPublisher(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to create publisher: %v", err)
+		}
+		defer publisher.Close()
+
+		forward = func(ctx context.Context, d rabbitmq.Delivery) error {
+			return publisher.PublishDelivery(ctx, d, exchange, targetRoutingKey(d))
+		}
+	}
+
+	stats, err := consumer.Move(ctx, cfg.DryRun, forward)
+	if errors.Is(err, context.Canceled) {
+		color.Yellow("Interrupted, %d of %d messages moved.", stats.Moved, stats.Scanned)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("move stopped after %d messages: %v", stats.Moved, err)
+	}
+
+	if cfg.DryRun {
+		color.Green("Dry run complete. %d of %d messages would be moved, %d would stay.", stats.Moved, stats.Scanned, stats.Skipped)
+	} else {
+		color.Green("Move complete. %d of %d messages moved, %d left in queue.", stats.Moved, stats.Scanned, stats.Skipped)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package app
+
+import (
+	"context"
+
+	"github.com/marianozunino/goq/internal/config"
+)
+
+// Peek is a package-level function for convenience
+func Peek(ctx context.Context, cfg *config.Config) error {
+	processor, err := NewMessageProcessor(cfg)
+	if err != nil {
+		return err
+	}
+	return processor.Peek(ctx)
+}
@@ -1,8 +1,11 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/marianozunino/goq/internal/config"
@@ -15,6 +18,16 @@ type MessageProcessor struct {
 	config   *config.Config
 	consumer *rmq.Consumer
 	exporter exporter.Exporter
+	summary  summary
+}
+
+// summary holds the message counters reported when processing ends
+type summary struct {
+	consumed   int
+	filtered   int
+	written    int
+	failed     int
+	reconnects int
 }
 
 // NewMessageProcessor creates a new MessageProcessor
@@ -34,6 +47,7 @@ func NewMessageProcessor(cfg *config.Config) (*MessageProcessor, error) {
 	// Create exporter
 	exp, err := exporter.NewExporter(cfg)
 	if err != nil {
+		consumer.Close()
 		return nil, fmt.Errorf("failed to create file exporter: %v", err)
 	}
 
@@ -45,10 +59,10 @@ func NewMessageProcessor(cfg *config.Config) (*MessageProcessor, error) {
 }
 
 // Dump processes messages from the main queue
-func (mp *MessageProcessor) Dump() error {
-	defer mp.exporter.Close()
+func (mp *MessageProcessor) Dump(ctx context.Context) error {
+	defer mp.close()
 
-	msgs, err := mp.consumer.Consume()
+	msgs, err := mp.consumer.Consume(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to consume messages: %v", err)
 	}
@@ -58,66 +72,176 @@ func (mp *MessageProcessor) Dump() error {
 	}
 	log.Println("Waiting for messages. To exit press CTRL+C")
 
-	return mp.processMessages(msgs)
+	return mp.processMessages(ctx, msgs)
 }
 
 // Monitor creates a temporary queue and processes messages
-func (mp *MessageProcessor) Monitor() error {
-	defer mp.exporter.Close()
+func (mp *MessageProcessor) Monitor(ctx context.Context) error {
+	defer mp.close()
 
 	// Consume messages from temporary queue
-	msgs, err := mp.consumer.Consume()
+	msgs, err := mp.consumer.Consume(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to consume messages: %v", err)
 	}
 
-	return mp.endlessConsume(msgs)
+	return mp.processMessages(ctx, msgs)
 }
 
-func (mp *MessageProcessor) processMessages(status <-chan rmq.ConsumerStatus) error {
+// Peek reads a batch of messages from the head of the queue without consuming them
+func (mp *MessageProcessor) Peek(ctx context.Context) error {
+	defer mp.close()
+
+	msgs, err := mp.consumer.Peek(ctx, mp.config.PeekCount)
+	if err != nil {
+		return fmt.Errorf("failed to peek messages: %v", err)
+	}
+
+	return mp.processMessages(ctx, msgs)
+}
+
+// close stops the consumer before flushing and closing the exporter, so no
+// delivery is acknowledged after the output has been closed
+func (mp *MessageProcessor) close() {
+	if err := mp.consumer.Close(); err != nil {
+		log.Printf("Failed to close consumer: %v", err)
+	}
+	if err := mp.exporter.Close(); err != nil {
+		log.Printf("Failed to close exporter: %v", err)
+	}
+}
+
+// processMessages exports every status until the consumer reports completion,
+// the status channel is closed or one of the configured limits is reached,
+// then prints the summary
+func (mp *MessageProcessor) processMessages(ctx context.Context, status <-chan rmq.ConsumerStatus) error {
 	blue := color.New(color.FgBlue)
-	for s := range status {
+
+	var deadline <-chan time.Time
+	if mp.config.Duration > 0 {
+		timer := time.NewTimer(mp.config.Duration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if mp.config.IdleTimeout > 0 {
+		idleTimer = time.NewTimer(mp.config.IdleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
+loop:
+	for {
+		var s rmq.ConsumerStatus
+		var ok bool
+
+		select {
+		case s, ok = <-status:
+			if !ok {
+				break loop
+			}
+		case <-deadline:
+			fmt.Println()
+			color.Yellow("Duration of %s reached, stopping.", mp.config.Duration)
+			break loop
+		case <-idle:
+			fmt.Println()
+			color.Yellow("No messages for %s, stopping.", mp.config.IdleTimeout)
+			break loop
+		}
+
+		if idleTimer != nil && s.ConsumedMessages > mp.summary.consumed {
+			resetTimer(idleTimer, mp.config.IdleTimeout)
+		}
+		mp.summary.consumed = s.ConsumedMessages
+		mp.summary.filtered = s.FilteredMessages
+
+		// Mark the messages missed while the connection was down
+		if s.Gap != nil {
+			mp.summary.reconnects++
+			fmt.Println()
+			color.Yellow("Connection was down for %s, messages published meanwhile were missed.", s.Gap.Duration().Round(time.Millisecond))
+			if err := mp.exporter.WriteMessage(s.Gap.Delivery()); err != nil {
+				log.Printf("Failed to write gap marker: %v", err)
+			}
+		}
+
 		// when message is null is because the message was filtered
 		if s.Message != nil {
 			if err := mp.exporter.WriteMessage(*s.Message); err != nil {
+				mp.summary.failed++
 				log.Printf("Failed to write message: %v", err)
-				continue
-			}
-
-			switch mp.config.Writer {
-			case config.FileWriterKind:
-				blue.Printf("\rMessages processed: %d", s.ConsumedMessages)
-			case config.ConsoleExporterKind:
-				blue.Println("*****")
+				if errors.Is(err, exporter.ErrOutputFailed) {
+					fmt.Println()
+					color.Red("Output failed, stopping.")
+					break
+				}
+			} else {
+				mp.summary.written++
+
+				switch {
+				case mp.config.HasWriter(config.ConsoleExporterKind):
+					blue.Println("*****")
+				case mp.config.HasWriter(config.FileWriterKind), mp.config.HasWriter(config.SQLiteExporterKind), mp.config.OutputFile != "":
+					blue.Printf("\rMessages processed: %d", s.ConsumedMessages)
+				}
 			}
 		}
 
 		if s.Complete {
 			fmt.Println()
 			color.Green("Message processing complete.")
-			return nil
+			break
 		}
+
+		if reason := mp.limitReached(); reason != "" {
+			fmt.Println()
+			color.Yellow("%s, stopping.", reason)
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		fmt.Println()
+		color.Yellow("Interrupted, shutting down.")
+	}
+	mp.printSummary()
+
+	if err := mp.consumer.Err(); err != nil {
+		return fmt.Errorf("consumer error: %v", err)
+	}
+	if mp.summary.failed > 0 {
+		return fmt.Errorf("failed to write %d messages", mp.summary.failed)
 	}
 	return nil
 }
 
-func (mp *MessageProcessor) endlessConsume(status <-chan rmq.ConsumerStatus) error {
-	blue := color.New(color.FgBlue)
-	for s := range status {
-		// when message is null is because the message was filtered
-		if s.Message != nil {
-			if err := mp.exporter.WriteMessage(*s.Message); err != nil {
-				log.Printf("Failed to write message: %v", err)
-				continue
-			}
+// limitReached reports why processing should stop based on the message
+// count limits, or an empty string while it should go on
+func (mp *MessageProcessor) limitReached() string {
+	if mp.config.MaxMessages > 0 && mp.summary.written >= mp.config.MaxMessages {
+		return fmt.Sprintf("Wrote %d messages", mp.summary.written)
+	}
+	if mp.config.MaxConsumed > 0 && mp.summary.consumed >= mp.config.MaxConsumed {
+		return fmt.Sprintf("Consumed %d messages", mp.summary.consumed)
+	}
+	return ""
+}
 
-			switch mp.config.Writer {
-			case config.FileWriterKind:
-				blue.Printf("\rMessages processed: %d", s.ConsumedMessages)
-			case config.ConsoleExporterKind:
-				blue.Println("*****")
-			}
+// resetTimer restarts t, draining a pending tick so it cannot fire early
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
 		}
 	}
-	return nil
+	t.Reset(d)
+}
+
+func (mp *MessageProcessor) printSummary() {
+	color.Green("Summary: consumed %d, filtered out %d, written %d, failed %d, reconnects %d",
+		mp.summary.consumed, mp.summary.filtered, mp.summary.written, mp.summary.failed, mp.summary.reconnects)
 }
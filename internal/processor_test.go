@@ -1,10 +1,17 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/marianozunino/goq/internal/config"
+	"github.com/marianozunino/goq/internal/exporter"
+	"github.com/marianozunino/goq/internal/rmq"
 	"github.com/marianozunino/goq/internal/testutil"
+	"github.com/wagslane/go-rabbitmq"
 )
 
 func TestNewMessageProcessor_ValidConfig(t *testing.T) {
@@ -68,13 +75,7 @@ func TestNewMessageProcessor_WithFilters(t *testing.T) {
 			Queue:       "test-queue",
 			AutoAck:     true,
 			Writer:      "console",
-			FilterConfig: struct {
-				IncludePatterns []string
-				ExcludePatterns []string
-				JSONFilter      string
-				MaxMessageSize  int
-				RegexFilter     string
-			}{
+			FilterConfig: config.FilterConfig{
 				IncludePatterns: []string{"test"},
 				ExcludePatterns: []string{"debug"},
 				JSONFilter:      `.type == "test"`,
@@ -309,3 +310,262 @@ func TestMessageProcessor_WithExchange(t *testing.T) {
 		}
 	})
 }
+
+// recordingExporter collects written messages and fails on demand
+type recordingExporter struct {
+	written []rabbitmq.Delivery
+	failOn  int
+	failErr error
+	closed  bool
+}
+
+func (e *recordingExporter) WriteMessage(msg rabbitmq.Delivery) error {
+	if e.failOn > 0 && len(e.written)+1 == e.failOn {
+		e.failOn = 0
+		if e.failErr != nil {
+			return e.failErr
+		}
+		return errors.New("write failed")
+	}
+	e.written = append(e.written, msg)
+	return nil
+}
+
+func (e *recordingExporter) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestMessageProcessor_ProcessMessagesSummary(t *testing.T) {
+	exp := &recordingExporter{}
+	processor := &MessageProcessor{
+		config:   &config.Config{Writer: config.ConsoleExporterKind},
+		consumer: &rmq.Consumer{},
+		exporter: exp,
+	}
+
+	msg := &rabbitmq.Delivery{}
+	msg.Body = []byte(`{"test": "data"}`)
+
+	status := make(chan rmq.ConsumerStatus, 4)
+	status <- rmq.ConsumerStatus{ConsumedMessages: 1, Message: msg}
+	status <- rmq.ConsumerStatus{ConsumedMessages: 2, FilteredMessages: 1}
+	status <- rmq.ConsumerStatus{ConsumedMessages: 3, FilteredMessages: 1, Message: msg}
+	status <- rmq.ConsumerStatus{ConsumedMessages: 3, FilteredMessages: 1, Complete: true}
+	close(status)
+
+	if err := processor.processMessages(context.Background(), status); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := summary{consumed: 3, filtered: 1, written: 2}
+	if processor.summary != expected {
+		t.Errorf("Expected summary %+v, got %+v", expected, processor.summary)
+	}
+}
+
+func TestMessageProcessor_ProcessMessagesGap(t *testing.T) {
+	exp := &recordingExporter{}
+	processor := &MessageProcessor{
+		config:   &config.Config{Writer: config.ConsoleExporterKind},
+		consumer: &rmq.Consumer{},
+		exporter: exp,
+	}
+
+	msg := &rabbitmq.Delivery{}
+	msg.Body = []byte(`{"test": "data"}`)
+	start := time.Now()
+
+	status := make(chan rmq.ConsumerStatus, 3)
+	status <- rmq.ConsumerStatus{ConsumedMessages: 1, Message: msg}
+	status <- rmq.ConsumerStatus{ConsumedMessages: 1, Gap: &rmq.Gap{Start: start, End: start.Add(time.Second), Reconnects: 1}}
+	status <- rmq.ConsumerStatus{ConsumedMessages: 2, Message: msg}
+	close(status)
+
+	if err := processor.processMessages(context.Background(), status); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(exp.written) != 3 || exp.written[1].RoutingKey != rmq.GapRoutingKey {
+		t.Fatalf("Expected a gap marker between the messages, got %v", exp.written)
+	}
+	expected := summary{consumed: 2, written: 2, reconnects: 1}
+	if processor.summary != expected {
+		t.Errorf("Expected summary %+v, got %+v", expected, processor.summary)
+	}
+}
+
+func TestMessageProcessor_ProcessMessagesWriteFailure(t *testing.T) {
+	exp := &recordingExporter{failOn: 1}
+	processor := &MessageProcessor{
+		config:   &config.Config{Writer: config.ConsoleExporterKind},
+		consumer: &rmq.Consumer{},
+		exporter: exp,
+	}
+
+	msg := &rabbitmq.Delivery{}
+	msg.Body = []byte(`{"test": "data"}`)
+
+	status := make(chan rmq.ConsumerStatus, 2)
+	status <- rmq.ConsumerStatus{ConsumedMessages: 1, Message: msg}
+	status <- rmq.ConsumerStatus{ConsumedMessages: 2, Message: msg}
+	close(status)
+
+	if err := processor.processMessages(context.Background(), status); err == nil {
+		t.Error("Expected error when a message could not be written")
+	}
+
+	if processor.summary.written != 1 || processor.summary.failed != 1 {
+		t.Errorf("Expected 1 written and 1 failed, got %+v", processor.summary)
+	}
+}
+
+func TestMessageProcessor_ProcessMessagesOutputFailed(t *testing.T) {
+	exp := &recordingExporter{failOn: 1, failErr: fmt.Errorf("%w: output 1 (file): disk full", exporter.ErrOutputFailed)}
+	processor := &MessageProcessor{
+		config:   &config.Config{Writer: config.ConsoleExporterKind},
+		consumer: &rmq.Consumer{},
+		exporter: exp,
+	}
+
+	msg := &rabbitmq.Delivery{}
+	msg.Body = []byte(`{"test": "data"}`)
+
+	status := make(chan rmq.ConsumerStatus, 2)
+	status <- rmq.ConsumerStatus{ConsumedMessages: 1, Message: msg}
+	status <- rmq.ConsumerStatus{ConsumedMessages: 2, Message: msg}
+	close(status)
+
+	if err := processor.processMessages(context.Background(), status); err == nil {
+		t.Error("Expected error when an output failed")
+	}
+
+	if processor.summary.written != 0 || processor.summary.failed != 1 {
+		t.Errorf("Expected processing to stop at the failed output, got %+v", processor.summary)
+	}
+}
+
+func TestMessageProcessor_CloseFlushesExporter(t *testing.T) {
+	exp := &recordingExporter{}
+	processor := &MessageProcessor{
+		config:   &config.Config{},
+		consumer: &rmq.Consumer{},
+		exporter: exp,
+	}
+
+	processor.close()
+
+	if !exp.closed {
+		t.Error("Expected exporter to be closed")
+	}
+}
+
+func TestMessageProcessor_MaxMessages(t *testing.T) {
+	exp := &recordingExporter{}
+	processor := &MessageProcessor{
+		config:   &config.Config{Writer: config.ConsoleExporterKind, MaxMessages: 2},
+		consumer: &rmq.Consumer{},
+		exporter: exp,
+	}
+
+	msg := &rabbitmq.Delivery{}
+	msg.Body = []byte(`{"test": "data"}`)
+
+	// The channel is left open: the limit alone has to end processing
+	status := make(chan rmq.ConsumerStatus, 4)
+	status <- rmq.ConsumerStatus{ConsumedMessages: 1, Message: msg}
+	status <- rmq.ConsumerStatus{ConsumedMessages: 2, FilteredMessages: 1}
+	status <- rmq.ConsumerStatus{ConsumedMessages: 3, FilteredMessages: 1, Message: msg}
+	status <- rmq.ConsumerStatus{ConsumedMessages: 4, FilteredMessages: 1, Message: msg}
+
+	if err := processor.processMessages(context.Background(), status); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(exp.written) != 2 {
+		t.Errorf("Expected 2 written messages, got %d", len(exp.written))
+	}
+}
+
+func TestMessageProcessor_MaxConsumed(t *testing.T) {
+	exp := &recordingExporter{}
+	processor := &MessageProcessor{
+		config:   &config.Config{Writer: config.ConsoleExporterKind, MaxConsumed: 2},
+		consumer: &rmq.Consumer{},
+		exporter: exp,
+	}
+
+	msg := &rabbitmq.Delivery{}
+	msg.Body = []byte(`{"test": "data"}`)
+
+	status := make(chan rmq.ConsumerStatus, 3)
+	status <- rmq.ConsumerStatus{ConsumedMessages: 1, FilteredMessages: 1}
+	status <- rmq.ConsumerStatus{ConsumedMessages: 2, FilteredMessages: 2}
+	status <- rmq.ConsumerStatus{ConsumedMessages: 3, FilteredMessages: 2, Message: msg}
+
+	if err := processor.processMessages(context.Background(), status); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := summary{consumed: 2, filtered: 2}
+	if processor.summary != expected {
+		t.Errorf("Expected summary %+v, got %+v", expected, processor.summary)
+	}
+}
+
+func TestMessageProcessor_IdleTimeout(t *testing.T) {
+	exp := &recordingExporter{}
+	processor := &MessageProcessor{
+		config:   &config.Config{Writer: config.ConsoleExporterKind, IdleTimeout: 50 * time.Millisecond},
+		consumer: &rmq.Consumer{},
+		exporter: exp,
+	}
+
+	msg := &rabbitmq.Delivery{}
+	msg.Body = []byte(`{"test": "data"}`)
+
+	status := make(chan rmq.ConsumerStatus)
+	go func() {
+		for i := 1; i <= 3; i++ {
+			status <- rmq.ConsumerStatus{ConsumedMessages: i, Message: msg}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	start := time.Now()
+	if err := processor.processMessages(context.Background(), status); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(exp.written) != 3 {
+		t.Errorf("Expected every message before the idle timeout to be written, got %d", len(exp.written))
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected processing to stop once idle, took %s", elapsed)
+	}
+}
+
+func TestMessageProcessor_Duration(t *testing.T) {
+	processor := &MessageProcessor{
+		config:   &config.Config{Writer: config.ConsoleExporterKind, Duration: 50 * time.Millisecond},
+		consumer: &rmq.Consumer{},
+		exporter: &recordingExporter{},
+	}
+
+	status := make(chan rmq.ConsumerStatus)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- processor.processMessages(context.Background(), status)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected processing to stop after the configured duration")
+	}
+}
@@ -0,0 +1,231 @@
+package protobuf
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/marianozunino/goq/internal/config"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// TypeHeader is the header a dump records the message type of a decoded
+// body in, so replay encodes it with the same type. goq removes it before
+// publishing.
+const TypeHeader = "x-goq-proto-type"
+
+// Decoder turns protobuf bodies into JSON using the message types of one or
+// more descriptor sets (as written by protoc --descriptor_set_out)
+type Decoder struct {
+	files       *protoregistry.Files
+	marshal     protojson.MarshalOptions
+	unmarshal   protojson.UnmarshalOptions
+	defaultType string
+	mappings    []mapping
+	descriptors map[string]protoreflect.MessageDescriptor
+	mu          sync.Mutex
+}
+
+// mapping selects the message type of a delivery by routing key or header
+type mapping struct {
+	routingKey *regexp.Regexp
+	header     string
+	value      string
+	typeName   string
+}
+
+// NewDecoder loads the configured descriptor sets. It returns nil when no
+// descriptor set is configured, so protobuf decoding stays disabled.
+func NewDecoder(cfg *config.Config) (*Decoder, error) {
+	if len(cfg.ProtoDescriptors) == 0 {
+		if cfg.ProtoType != "" || len(cfg.ProtoMappings) > 0 {
+			return nil, fmt.Errorf("protobuf types are configured but no descriptor set was given (use --proto-descriptor)")
+		}
+		return nil, nil
+	}
+
+	files, err := loadDescriptorSets(cfg.ProtoDescriptors)
+	if err != nil {
+		return nil, err
+	}
+
+	types := dynamicpb.NewTypes(files)
+	d := &Decoder{
+		files:       files,
+		marshal:     protojson.MarshalOptions{Resolver: types},
+		unmarshal:   protojson.UnmarshalOptions{Resolver: types},
+		defaultType: normalizeTypeName(cfg.ProtoType),
+		descriptors: map[string]protoreflect.MessageDescriptor{},
+	}
+
+	if d.defaultType != "" {
+		if _, err := d.descriptor(d.defaultType); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, m := range cfg.ProtoMappings {
+		compiled := mapping{
+			header:   m.Header,
+			value:    m.Value,
+			typeName: normalizeTypeName(m.Type),
+		}
+
+		switch {
+		case m.RoutingKey != "" && m.Header != "":
+			return nil, fmt.Errorf("proto mapping %d: use either routing-key or header, not both", i+1)
+		case m.RoutingKey != "":
+			regex, err := regexp.Compile(m.RoutingKey)
+			if err != nil {
+				return nil, fmt.Errorf("proto mapping %d: invalid routing key pattern: %v", i+1, err)
+			}
+			compiled.routingKey = regex
+		case m.Header == "":
+			return nil, fmt.Errorf("proto mapping %d: a routing-key or header is required", i+1)
+		}
+
+		// A header mapping without a type takes the type name from the header
+		if compiled.typeName == "" && compiled.header == "" {
+			return nil, fmt.Errorf("proto mapping %d: a type is required", i+1)
+		}
+		if compiled.typeName != "" {
+			if _, err := d.descriptor(compiled.typeName); err != nil {
+				return nil, fmt.Errorf("proto mapping %d: %v", i+1, err)
+			}
+		}
+
+		d.mappings = append(d.mappings, compiled)
+	}
+
+	return d, nil
+}
+
+// TypeFor returns the message type of a delivery: the first matching
+// mapping wins, then the default type. An empty name means the body is not
+// protobuf as far as the configuration knows.
+func (d *Decoder) TypeFor(routingKey string, headers map[string]interface{}) string {
+	for _, m := range d.mappings {
+		if m.routingKey != nil {
+			if m.routingKey.MatchString(routingKey) {
+				return m.typeName
+			}
+			continue
+		}
+
+		value, ok := headers[m.header]
+		if !ok {
+			continue
+		}
+		if m.typeName == "" {
+			return normalizeTypeName(fmt.Sprint(value))
+		}
+		if m.value == "" || fmt.Sprint(value) == m.value {
+			return m.typeName
+		}
+	}
+	return d.defaultType
+}
+
+// Decode parses body as typeName and returns its canonical JSON form
+func (d *Decoder) Decode(typeName string, body []byte) ([]byte, error) {
+	md, err := d.descriptor(typeName)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(body, msg); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", typeName, err)
+	}
+
+	return d.marshal.Marshal(msg)
+}
+
+// Encode parses the JSON form of typeName, as written by Decode, back into
+// its binary encoding
+func (d *Decoder) Encode(typeName string, data []byte) ([]byte, error) {
+	md, err := d.descriptor(typeName)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if err := d.unmarshal.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %v", typeName, err)
+	}
+
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+// descriptor looks up a message type, caching the result
+func (d *Decoder) descriptor(typeName string) (protoreflect.MessageDescriptor, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if md, ok := d.descriptors[typeName]; ok {
+		return md, nil
+	}
+
+	desc, err := d.files.FindDescriptorByName(protoreflect.FullName(typeName))
+	if err != nil {
+		return nil, fmt.Errorf("unknown protobuf message type %q", typeName)
+	}
+	md, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a protobuf message type", typeName)
+	}
+
+	d.descriptors[typeName] = md
+	return md, nil
+}
+
+// loadDescriptorSets merges the files of every descriptor set into a single
+// registry, so types may refer to each other across sets
+func loadDescriptorSets(paths []string) (*protoregistry.Files, error) {
+	merged := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read descriptor set: %v", err)
+		}
+
+		var set descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &set); err != nil {
+			return nil, fmt.Errorf("invalid descriptor set %s: %v", path, err)
+		}
+
+		for _, file := range set.GetFile() {
+			if seen[file.GetName()] {
+				continue
+			}
+			seen[file.GetName()] = true
+			merged.File = append(merged.File, file)
+		}
+	}
+
+	files, err := protodesc.NewFiles(merged)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %v", err)
+	}
+	return files, nil
+}
+
+// normalizeTypeName accepts names as written in .proto files, with a leading
+// dot as in descriptors, or as a type URL
+func normalizeTypeName(name string) string {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimPrefix(name, ".")
+}
@@ -0,0 +1,202 @@
+package protobuf
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/marianozunino/goq/internal/config"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// orderFile describes:
+//
+//	package com.acme;
+//	message OrderCreated { string id = 1; int32 quantity = 2; }
+//	message OrderCancelled { string id = 1; string reason = 2; }
+var orderFile = &descriptorpb.FileDescriptorProto{
+	Name:    proto.String("orders.proto"),
+	Package: proto.String("com.acme"),
+	Syntax:  proto.String("proto3"),
+	MessageType: []*descriptorpb.DescriptorProto{
+		{
+			Name: proto.String("OrderCreated"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("id"), JsonName: proto.String("id"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("quantity"), JsonName: proto.String("quantity"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			},
+		},
+		{
+			Name: proto.String("OrderCancelled"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("id"), JsonName: proto.String("id"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("reason"), JsonName: proto.String("reason"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			},
+		},
+	},
+}
+
+// writeDescriptorSet writes the test descriptor set and returns its path
+func writeDescriptorSet(t *testing.T) string {
+	data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{orderFile}})
+	if err != nil {
+		t.Fatalf("Failed to marshal descriptor set: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "set.pb")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Failed to write descriptor set: %v", err)
+	}
+	return path
+}
+
+// encodeOrder builds a binary OrderCreated message
+func encodeOrder(t *testing.T, id string, quantity int32) []byte {
+	file, err := protodesc.NewFile(orderFile, nil)
+	if err != nil {
+		t.Fatalf("Failed to build file descriptor: %v", err)
+	}
+
+	md := file.Messages().ByName("OrderCreated")
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(md.Fields().ByName("id"), protoreflect.ValueOfString(id))
+	msg.Set(md.Fields().ByName("quantity"), protoreflect.ValueOfInt32(quantity))
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal order: %v", err)
+	}
+	return data
+}
+
+func TestNewDecoder_Disabled(t *testing.T) {
+	decoder, err := NewDecoder(&config.Config{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decoder != nil {
+		t.Error("Expected no decoder without descriptor sets")
+	}
+
+	if _, err := NewDecoder(&config.Config{ProtoType: "com.acme.OrderCreated"}); err == nil {
+		t.Error("Expected error for a type without descriptor set")
+	}
+}
+
+func TestNewDecoder_InvalidConfig(t *testing.T) {
+	path := writeDescriptorSet(t)
+
+	tests := []struct {
+		name string
+		cfg  *config.Config
+	}{
+		{name: "missing file", cfg: &config.Config{ProtoDescriptors: []string{filepath.Join(t.TempDir(), "missing.pb")}}},
+		{name: "unknown default type", cfg: &config.Config{ProtoDescriptors: []string{path}, ProtoType: "com.acme.Unknown"}},
+		{name: "unknown mapped type", cfg: &config.Config{ProtoDescriptors: []string{path}, ProtoMappings: []config.ProtoMapping{{RoutingKey: "orders.*", Type: "com.acme.Unknown"}}}},
+		{name: "mapping without matcher", cfg: &config.Config{ProtoDescriptors: []string{path}, ProtoMappings: []config.ProtoMapping{{Type: "com.acme.OrderCreated"}}}},
+		{name: "routing key mapping without type", cfg: &config.Config{ProtoDescriptors: []string{path}, ProtoMappings: []config.ProtoMapping{{RoutingKey: "orders.*"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDecoder(tt.cfg); err == nil {
+				t.Error("Expected configuration error")
+			}
+		})
+	}
+}
+
+func TestDecoder_Decode(t *testing.T) {
+	decoder, err := NewDecoder(&config.Config{
+		ProtoDescriptors: []string{writeDescriptorSet(t)},
+		ProtoType:        ".com.acme.OrderCreated",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+
+	decoded, err := decoder.Decode(decoder.TypeFor("any", nil), encodeOrder(t, "o-1", 3))
+	if err != nil {
+		t.Fatalf("Failed to decode order: %v", err)
+	}
+
+	var order map[string]interface{}
+	if err := json.Unmarshal(decoded, &order); err != nil {
+		t.Fatalf("Expected JSON output, got %s", decoded)
+	}
+	if order["id"] != "o-1" || order["quantity"] != float64(3) {
+		t.Errorf("Expected decoded order fields, got %v", order)
+	}
+
+	if _, err := decoder.Decode("com.acme.OrderCreated", []byte{0xff, 0xff, 0xff}); err == nil || !strings.Contains(err.Error(), "failed to decode") {
+		t.Errorf("Expected decode error for garbage input, got %v", err)
+	}
+}
+
+func TestDecoder_EncodeRoundTrip(t *testing.T) {
+	decoder, err := NewDecoder(&config.Config{
+		ProtoDescriptors: []string{writeDescriptorSet(t)},
+		ProtoType:        "com.acme.OrderCreated",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+
+	body := encodeOrder(t, "o-1", 3)
+	decoded, err := decoder.Decode("com.acme.OrderCreated", body)
+	if err != nil {
+		t.Fatalf("Failed to decode order: %v", err)
+	}
+	encoded, err := decoder.Encode("com.acme.OrderCreated", decoded)
+	if err != nil {
+		t.Fatalf("Failed to encode order: %v", err)
+	}
+	if !bytes.Equal(encoded, body) {
+		t.Errorf("Expected the original body back, got %x, want %x", encoded, body)
+	}
+
+	if _, err := decoder.Encode("com.acme.OrderCreated", []byte(`{"unknown": 1}`)); err == nil || !strings.Contains(err.Error(), "failed to encode") {
+		t.Errorf("Expected encode error for a field the type does not have, got %v", err)
+	}
+}
+
+func TestDecoder_TypeFor(t *testing.T) {
+	decoder, err := NewDecoder(&config.Config{
+		ProtoDescriptors: []string{writeDescriptorSet(t)},
+		ProtoMappings: []config.ProtoMapping{
+			{RoutingKey: `^orders\.cancelled$`, Type: "com.acme.OrderCancelled"},
+			{Header: "x-event", Value: "created", Type: "com.acme.OrderCreated"},
+			{Header: "x-proto-type"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		routingKey string
+		headers    map[string]interface{}
+		expected   string
+	}{
+		{name: "routing key", routingKey: "orders.cancelled", expected: "com.acme.OrderCancelled"},
+		{name: "header value", routingKey: "orders.x", headers: map[string]interface{}{"x-event": "created"}, expected: "com.acme.OrderCreated"},
+		{name: "type from header", headers: map[string]interface{}{"x-proto-type": "type.googleapis.com/com.acme.OrderCancelled"}, expected: "com.acme.OrderCancelled"},
+		{name: "no match", routingKey: "users.created", headers: map[string]interface{}{"x-event": "deleted"}, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decoder.TypeFor(tt.routingKey, tt.headers); got != tt.expected {
+				t.Errorf("Expected type %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/marianozunino/goq/internal/model"
+	"github.com/marianozunino/goq/internal/protobuf"
+	"github.com/marianozunino/goq/internal/rmq"
+)
+
+// Replay re-publishes the messages of a dump file back to RabbitMQ
+func Replay(ctx context.Context, cfg *config.Config) error {
+	if _, err := parseRate(cfg.PublishRate); err != nil {
+		return err
+	}
+
+	codecs, err := model.NewCodecRegistry(cfg.AvroSchemas)
+	if err != nil {
+		return err
+	}
+	protos, err := protobuf.NewDecoder(cfg)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(cfg.InputFile)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %v", err)
+	}
+	defer file.Close()
+
+	publisher, err := rmq.NewPublisher(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create publisher: %v", err)
+	}
+	defer publisher.Close()
+
+	blue := color.New(color.FgBlue)
+	published := 0
+	stats, err := replayMessages(ctx, cfg, codecs, protos, file, func(ctx context.Context, msg model.Message, exchange, routingKey string) error {
+		if err := publisher.Publish(ctx, msg, exchange, routingKey); err != nil {
+			return err
+		}
+		published++
+		blue.Printf("\rMessages published: %d", published)
+		return nil
+	})
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+
+	if stats.gaps > 0 {
+		color.Yellow("Skipped %d gap markers, they record outages of the monitor session and are not messages.", stats.gaps)
+	}
+	if ctx.Err() != nil {
+		color.Yellow("Interrupted, %d messages published.", stats.published)
+		return nil
+	}
+	color.Green("Replay complete. %d messages published.", stats.published)
+	return nil
+}
+
+// replayStats counts the records of a replay
+type replayStats struct {
+	published int
+	gaps      int
+}
+
+// replayMessages reads the records of a dump and hands every message to
+// publish, with the exchange and routing key it is replayed to. Gap markers
+// written by monitor are skipped.
+func replayMessages(ctx context.Context, cfg *config.Config, codecs *model.CodecRegistry, protos *protobuf.Decoder, r io.Reader, publish func(context.Context, model.Message, string, string) error) (*replayStats, error) {
+	interval, err := parseRate(cfg.PublishRate)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(r)
+	stats := &replayStats{}
+
+	for record := 1; ctx.Err() == nil; record++ {
+		var msg model.Message
+		if err := decoder.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return stats, fmt.Errorf("failed to parse message %d: %v", record, err)
+		}
+
+		if _, ok := msg.Headers[rmq.GapHeader]; ok {
+			stats.gaps++
+			continue
+		}
+
+		if err := encodeBody(codecs, protos, &msg); err != nil {
+			return stats, fmt.Errorf("failed to encode message %d: %v", record, err)
+		}
+
+		exchange := replayExchange(cfg, msg)
+		routingKey := msg.RoutingKey
+		if cfg.RoutingKeyOverride != "" {
+			routingKey = cfg.RoutingKeyOverride
+		}
+
+		if stats.published > 0 && interval > 0 {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				continue
+			}
+		}
+
+		if err := publish(ctx, msg, exchange, routingKey); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return stats, fmt.Errorf("failed to replay message %d: %v", record, err)
+		}
+		stats.published++
+	}
+
+	return stats, nil
+}
+
+// replayExchange returns the exchange a message is replayed to: the recorded
+// one unless -e/--exchange is given on the command line. The replay command
+// copies it to TargetExchange only then, so an exchange set in the config
+// file does not redirect a replay.
+func replayExchange(cfg *config.Config, msg model.Message) string {
+	if cfg.TargetExchange != "" {
+		return cfg.TargetExchange
+	}
+	return msg.Exchange
+}
+
+// encodeBody turns a body that was decoded to JSON when it was dumped back
+// into its binary format. The format is the one recorded in the dump: the
+// protobuf type, codec and Avro schema headers written when the body was
+// decoded, or the content-type recorded with --full-message. --codec is not
+// used, it only applies to reading.
+func encodeBody(codecs *model.CodecRegistry, protos *protobuf.Decoder, msg *model.Message) error {
+	protoType, _ := msg.Headers[protobuf.TypeHeader].(string)
+	codecName, _ := msg.Headers[model.CodecHeader].(string)
+	schema, _ := msg.Headers[model.SchemaHeader].(string)
+	msg.Headers = withoutHeaders(msg.Headers, protobuf.TypeHeader, model.CodecHeader, model.SchemaHeader)
+
+	// Bodies that could not be decoded were dumped as they were published
+	if msg.BodyEncoding != "" || !json.Valid(msg.Body) {
+		return nil
+	}
+
+	if protoType != "" {
+		if protos == nil {
+			return fmt.Errorf("body was decoded as protobuf %s, replay it with the --proto-descriptor it was dumped with", protoType)
+		}
+		encoded, err := protos.Encode(protoType, msg.Body)
+		if err != nil {
+			return err
+		}
+		msg.Body = encoded
+		return nil
+	}
+
+	if codecName == "" && schema != "" {
+		codecName = model.CodecAvro
+	}
+
+	var codec model.Codec
+	if codecName != "" {
+		if codec = codecs.Select(codecName, ""); codec == nil {
+			if codecName == model.CodecAvro {
+				return fmt.Errorf("body was decoded as avro, replay it with the --avro-schema it was dumped with")
+			}
+			return fmt.Errorf("body was decoded with unknown codec %q", codecName)
+		}
+	} else if msg.Properties != nil {
+		codec = codecs.Select("", msg.Properties.ContentType)
+	}
+	if codec == nil {
+		return nil
+	}
+
+	var encoded []byte
+	var err error
+	if schemas, ok := codec.(model.SchemaCodec); ok && schema != "" {
+		encoded, err = schemas.EncodeSchema(msg.Body, schema)
+	} else {
+		encoded, err = codec.Encode(msg.Body)
+	}
+	if err != nil {
+		return err
+	}
+	msg.Body = encoded
+	return nil
+}
+
+// withoutHeaders returns headers without the given names. The headers are
+// copied when one of them is present.
+func withoutHeaders(headers map[string]interface{}, names ...string) map[string]interface{} {
+	for _, name := range names {
+		if _, ok := headers[name]; !ok {
+			continue
+		}
+		copied := make(map[string]interface{}, len(headers))
+		for k, v := range headers {
+			copied[k] = v
+		}
+		for _, name := range names {
+			delete(copied, name)
+		}
+		return copied
+	}
+	return headers
+}
+
+// parseRate converts a rate such as "100/s", "600/m" or "50" into the
+// interval to wait between two publishes. An empty rate means no limit.
+func parseRate(rate string) (time.Duration, error) {
+	if rate == "" {
+		return 0, nil
+	}
+
+	count, unit, found := strings.Cut(rate, "/")
+	if !found {
+		unit = "s"
+	}
+
+	perUnit := time.Second
+	switch unit {
+	case "s":
+		perUnit = time.Second
+	case "m":
+		perUnit = time.Minute
+	case "h":
+		perUnit = time.Hour
+	default:
+		return 0, fmt.Errorf("invalid rate unit %q (use s, m or h)", unit)
+	}
+
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid rate %q: must be a positive number of messages", rate)
+	}
+
+	return time.Duration(float64(perUnit) / n), nil
+}
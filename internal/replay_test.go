@@ -0,0 +1,237 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/marianozunino/goq/internal/model"
+	"github.com/marianozunino/goq/internal/protobuf"
+	"github.com/marianozunino/goq/internal/testutil"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestReplayExchange(t *testing.T) {
+	msg := model.Message{Exchange: "orders"}
+
+	// Exchange alone comes from the config file
+	if got := replayExchange(&config.Config{Exchange: "events"}, msg); got != "orders" {
+		t.Errorf("Expected the recorded exchange, got %q", got)
+	}
+	if got := replayExchange(&config.Config{Exchange: "retry", TargetExchange: "retry"}, msg); got != "retry" {
+		t.Errorf("Expected -e to replace the recorded exchange, got %q", got)
+	}
+}
+
+func TestReplayMessages_SkipsGapMarkers(t *testing.T) {
+	dump := strings.Join([]string{
+		`{"headers": {}, "exchange": "orders", "routingKey": "order.created", "timestamp": 1, "body": {"id": 1}}`,
+		`{"headers": {"x-goq-gap": true}, "exchange": "", "routingKey": "goq.gap", "timestamp": 2, "body": {"gap": {"durationMs": 1500, "reconnects": 1}}}`,
+		`{"headers": {}, "exchange": "orders", "routingKey": "order.created", "timestamp": 3, "body": {"id": 2}}`,
+	}, "\n")
+	codecs, _ := model.NewCodecRegistry(nil)
+
+	var keys []string
+	stats, err := replayMessages(context.Background(), &config.Config{}, codecs, nil, strings.NewReader(dump), func(_ context.Context, msg model.Message, exchange, routingKey string) error {
+		keys = append(keys, exchange+"/"+routingKey)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if strings.Join(keys, ",") != "orders/order.created,orders/order.created" {
+		t.Errorf("Expected only the messages to be published, got %v", keys)
+	}
+	if stats.published != 2 || stats.gaps != 1 {
+		t.Errorf("Expected 2 messages published and 1 gap skipped, got %+v", *stats)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		rate     string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{rate: "", expected: 0},
+		{rate: "100/s", expected: 10 * time.Millisecond},
+		{rate: "60/m", expected: time.Second},
+		{rate: "3600/h", expected: time.Second},
+		{rate: "4", expected: 250 * time.Millisecond},
+		{rate: "0/s", wantErr: true},
+		{rate: "abc/s", wantErr: true},
+		{rate: "10/d", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		interval, err := parseRate(tt.rate)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Expected error for rate %q", tt.rate)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for rate %q: %v", tt.rate, err)
+			continue
+		}
+		if interval != tt.expected {
+			t.Errorf("Expected interval %v for rate %q, got %v", tt.expected, tt.rate, interval)
+		}
+	}
+}
+
+func TestEncodeBody(t *testing.T) {
+	codecs, err := model.NewCodecRegistry(nil)
+	if err != nil {
+		t.Fatalf("Failed to create codec registry: %v", err)
+	}
+
+	// Decoded msgpack body recorded with its content type
+	msg := model.Message{
+		Properties: &model.Properties{ContentType: "application/msgpack"},
+		Body:       []byte(`{"id": 1}`),
+	}
+	if err := encodeBody(codecs, nil, &msg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var value map[string]interface{}
+	if err := msgpack.Unmarshal(msg.Body, &value); err != nil {
+		t.Fatalf("Expected a msgpack body, got %q: %v", msg.Body, err)
+	}
+	if value["id"] != int64(1) {
+		t.Errorf("Expected id 1, got %v", value["id"])
+	}
+
+	// Plain JSON stays JSON
+	plain := model.Message{Body: []byte(`{"id": 1}`)}
+	if err := encodeBody(codecs, nil, &plain); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(plain.Body) != `{"id": 1}` {
+		t.Errorf("Expected JSON body to be left as is, got %q", plain.Body)
+	}
+
+	// Bodies that were dumped undecoded are published as they are
+	raw := model.Message{BodyEncoding: model.BodyEncodingBase64, Body: []byte{0xc1}}
+	if err := encodeBody(codecs, nil, &raw); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(raw.Body) != 1 || raw.Body[0] != 0xc1 {
+		t.Errorf("Expected binary body to be left as is, got %x", raw.Body)
+	}
+}
+
+func TestReplayMessages_RecordedCodec(t *testing.T) {
+	// Dumped without --full-message, so only the codec header tells the format
+	dump := `{"headers": {"x-goq-codec": "msgpack"}, "exchange": "orders", "routingKey": "order.created", "timestamp": 1, "body": {"id": 1}}
+{"headers": {}, "exchange": "orders", "routingKey": "order.created", "timestamp": 2, "body": {"id": 2}}`
+	codecs, _ := model.NewCodecRegistry(nil)
+
+	// --codec from the config file must not change how the dump is replayed
+	var published []model.Message
+	_, err := replayMessages(context.Background(), &config.Config{Codec: model.CodecCBOR}, codecs, nil, strings.NewReader(dump), func(_ context.Context, msg model.Message, _, _ string) error {
+		published = append(published, msg)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(published) != 2 {
+		t.Fatalf("Expected 2 messages published, got %d", len(published))
+	}
+
+	var value map[string]interface{}
+	if err := msgpack.Unmarshal(published[0].Body, &value); err != nil || value["id"] != int64(1) {
+		t.Errorf("Expected the recorded msgpack codec, got %x: %v", published[0].Body, err)
+	}
+	if _, ok := published[0].Headers[model.CodecHeader]; ok {
+		t.Errorf("Expected the codec header to be removed, got %v", published[0].Headers)
+	}
+	if string(published[1].Body) != `{"id": 2}` {
+		t.Errorf("Expected a JSON message to stay JSON, got %q", published[1].Body)
+	}
+}
+
+func TestEncodeBody_Protobuf(t *testing.T) {
+	cfg := &config.Config{ProtoDescriptors: []string{testutil.WriteOrderDescriptorSet(t)}}
+	protos, err := protobuf.NewDecoder(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	codecs, _ := model.NewCodecRegistry(nil)
+
+	// The body as dump writes it: decoded to JSON, with its type recorded
+	published := testutil.EncodeOrder(t, "o-1", 3)
+	decoded, err := protos.Decode(testutil.OrderType, published)
+	if err != nil {
+		t.Fatalf("Failed to decode order: %v", err)
+	}
+	msg := model.Message{
+		Headers: map[string]interface{}{protobuf.TypeHeader: testutil.OrderType, "x-tenant": "acme"},
+		Body:    decoded,
+	}
+
+	if err := encodeBody(codecs, protos, &msg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(msg.Body, published) {
+		t.Errorf("Expected the published protobuf body back, got %x, want %x", msg.Body, published)
+	}
+	if _, ok := msg.Headers[protobuf.TypeHeader]; ok || msg.Headers["x-tenant"] != "acme" {
+		t.Errorf("Expected only the type header to be removed, got %v", msg.Headers)
+	}
+
+	// Without the descriptor set the body cannot be encoded again
+	unencoded := model.Message{Headers: map[string]interface{}{protobuf.TypeHeader: testutil.OrderType}, Body: decoded}
+	if err := encodeBody(codecs, nil, &unencoded); err == nil || !strings.Contains(err.Error(), "--proto-descriptor") {
+		t.Errorf("Expected an error asking for the descriptor set, got %v", err)
+	}
+}
+
+func TestEncodeBody_AvroSchema(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"Order", "Shipment"} {
+		path := filepath.Join(dir, name+".avsc")
+		schema := `{"type": "record", "name": "` + name + `", "fields": [{"name": "id", "type": "string"}]}`
+		if err := os.WriteFile(path, []byte(schema), 0o644); err != nil {
+			t.Fatalf("Failed to write schema: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	codecs, err := model.NewCodecRegistry(paths)
+	if err != nil {
+		t.Fatalf("Failed to create codec registry: %v", err)
+	}
+	shipments, _ := model.NewCodecRegistry(paths[1:])
+	published, _ := shipments.Select(model.CodecAvro, "").Encode([]byte(`{"id": "s-1"}`))
+	schema, _ := codecs.Select(model.CodecAvro, "").(model.SchemaCodec).Schema(published)
+
+	msg := model.Message{
+		Headers: map[string]interface{}{model.SchemaHeader: schema, "x-tenant": "acme"},
+		Body:    []byte(`{"id": "s-1"}`),
+	}
+	if err := encodeBody(codecs, nil, &msg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(msg.Body, published) {
+		t.Errorf("Expected the recorded schema to be used, got %x, want %x", msg.Body, published)
+	}
+	if _, ok := msg.Headers[model.SchemaHeader]; ok || msg.Headers["x-tenant"] != "acme" {
+		t.Errorf("Expected only the schema header to be removed, got %v", msg.Headers)
+	}
+
+	// Without the schema header both schemas accept the record
+	unrecorded := model.Message{Headers: map[string]interface{}{model.CodecHeader: model.CodecAvro}, Body: []byte(`{"id": "s-1"}`)}
+	if err := encodeBody(codecs, nil, &unrecorded); err == nil {
+		t.Error("Expected a record several schemas accept to be refused")
+	}
+}
@@ -0,0 +1,150 @@
+package rmq
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+// Connection is how goq talks to the broker. It owns dialing, TLS, SASL,
+// heartbeats and the name and client properties the connection shows up
+// with in the management UI. Consumers and publishers attach to its
+// reconnecting connection, everything else asks it for a channel.
+type Connection struct {
+	config   *config.Config
+	name     string
+	settings amqp091.Config
+
+	mu      sync.Mutex
+	managed *rabbitmq.Conn
+	raw     *amqp091.Connection
+	closed  bool
+}
+
+// NewConnection prepares the connection described by cfg, connecting is
+// deferred to the first consumer, publisher or channel
+func NewConnection(cfg *config.Config) (*Connection, error) {
+	settings, err := connectionConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	settings.Heartbeat = cfg.Heartbeat
+
+	return &Connection{
+		config:   cfg,
+		name:     connectionName(cfg),
+		settings: settings,
+	}, nil
+}
+
+// Name returns the name the connection is registered with on the broker
+func (c *Connection) Name() string {
+	return c.name
+}
+
+// Channel opens a channel on the connection, dialing it first when it is not
+// open yet or was closed by the broker
+func (c *Connection) Channel() (*amqp091.Channel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, errors.New("connection is closed")
+	}
+	if c.raw == nil || c.raw.IsClosed() {
+		raw, err := amqp091.DialConfig(c.config.RabbitMQURL, c.amqpConfig())
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
+		}
+		c.raw = raw
+	}
+
+	ch, err := c.raw.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open channel: %v", err)
+	}
+	return ch, nil
+}
+
+// managedConn returns the reconnecting go-rabbitmq connection consumers and
+// publishers are created on, dialing it on first use
+func (c *Connection) managedConn() (*rabbitmq.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, errors.New("connection is closed")
+	}
+	if c.managed == nil {
+		managed, err := rabbitmq.NewConn(
+			c.config.RabbitMQURL,
+			rabbitmq.WithConnectionOptionsLogging,
+			rabbitmq.WithConnectionOptionsConfig(rabbitmq.Config(c.amqpConfig())),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
+		}
+		c.managed = managed
+	}
+	return c.managed, nil
+}
+
+// Close closes the connection and every channel opened on it
+func (c *Connection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	var errs []error
+	if c.managed != nil {
+		errs = append(errs, c.managed.Close())
+		c.managed = nil
+	}
+	if c.raw != nil {
+		if err := c.raw.Close(); err != nil && !errors.Is(err, amqp091.ErrClosed) {
+			errs = append(errs, err)
+		}
+		c.raw = nil
+	}
+	return errors.Join(errs...)
+}
+
+// amqpConfig returns the settings of one dial. amqp091 adds to the client
+// properties it is given, so every dial gets its own table.
+func (c *Connection) amqpConfig() amqp091.Config {
+	settings := c.settings
+	settings.Properties = amqp091.Table{
+		"product":         "goq",
+		"platform":        "Go",
+		"information":     "https://github.com/marianozunino/goq",
+		"connection_name": c.name,
+	}
+	return settings
+}
+
+// connectionName names the connection after the host and what goq does with
+// it, e.g. "goq@build-01 dump orders", so admins can tell who is attached
+func connectionName(cfg *config.Config) string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+
+	parts := []string{"goq@" + host}
+	if cfg.Command != "" {
+		parts = append(parts, cfg.Command)
+	}
+	switch {
+	case cfg.Queue != "":
+		parts = append(parts, cfg.Queue)
+	case cfg.Exchange != "":
+		parts = append(parts, cfg.Exchange)
+	}
+	return strings.Join(parts, " ")
+}
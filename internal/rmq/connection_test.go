@@ -0,0 +1,99 @@
+package rmq
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marianozunino/goq/internal/config"
+)
+
+func TestConnectionName(t *testing.T) {
+	host, _ := os.Hostname()
+
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		expected string
+	}{
+		{name: "queue", cfg: &config.Config{Command: "dump", Queue: "orders", Exchange: "events"}, expected: "goq@" + host + " dump orders"},
+		{name: "exchange", cfg: &config.Config{Command: "monitor", Exchange: "events"}, expected: "goq@" + host + " monitor events"},
+		{name: "no command", cfg: &config.Config{}, expected: "goq@" + host},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := connectionName(tt.cfg); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewConnection(t *testing.T) {
+	cfg := &config.Config{
+		Command:     "peek",
+		Queue:       "orders",
+		RabbitMQURL: "amqp://localhost:5672/%2F",
+		Heartbeat:   30 * time.Second,
+	}
+
+	conn, err := NewConnection(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err)
+	}
+	defer conn.Close()
+
+	if !strings.HasSuffix(conn.Name(), " peek orders") {
+		t.Errorf("Expected the name to tell the command and queue, got %q", conn.Name())
+	}
+
+	first, second := conn.amqpConfig(), conn.amqpConfig()
+	if first.Heartbeat != 30*time.Second {
+		t.Errorf("Expected the configured heartbeat, got %v", first.Heartbeat)
+	}
+	if first.Properties["connection_name"] != conn.Name() || first.Properties["product"] != "goq" {
+		t.Errorf("Expected the client properties to name the connection, got %v", first.Properties)
+	}
+
+	// amqp091 writes to the properties of every dial
+	first.Properties["capabilities"] = "changed"
+	if _, ok := second.Properties["capabilities"]; ok {
+		t.Error("Expected every dial to get its own client properties")
+	}
+}
+
+func TestNewConnection_InvalidConfig(t *testing.T) {
+	_, err := NewConnection(&config.Config{RabbitMQURL: "amqp://localhost/", TLSCA: "ca.pem"})
+	if err == nil || !strings.Contains(err.Error(), "--secure") {
+		t.Errorf("Expected the TLS settings to be checked, got %v", err)
+	}
+}
+
+func TestConnection_Channel(t *testing.T) {
+	// Reserve a port nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	conn, err := NewConnection(&config.Config{RabbitMQURL: "amqp://" + addr + "/%2F"})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err)
+	}
+
+	if _, err := conn.Channel(); err == nil || !strings.Contains(err.Error(), "failed to connect") {
+		t.Errorf("Expected the dial error, got %v", err)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Errorf("Expected closing an unused connection to succeed, got %v", err)
+	}
+	if _, err := conn.Channel(); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("Expected no channel once closed, got %v", err)
+	}
+}
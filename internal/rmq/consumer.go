@@ -1,25 +1,50 @@
 package rmq
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/marianozunino/goq/internal/compression"
 	"github.com/marianozunino/goq/internal/config"
 	"github.com/marianozunino/goq/internal/filter"
+	"github.com/marianozunino/goq/internal/model"
+	"github.com/marianozunino/goq/internal/protobuf"
 	"github.com/rabbitmq/amqp091-go"
 	"github.com/wagslane/go-rabbitmq"
 )
 
 type Consumer struct {
-	conn     *rabbitmq.Conn
+	conn     *Connection
 	consumer *rabbitmq.Consumer
 	config   *config.Config
 	filter   *filter.MessageFilter
+	proto    *protobuf.Decoder
+	codecs   *model.CodecRegistry
+	out      io.Writer // progress messages
 
 	totalMessages    int
 	consumedMessages int
+	reconnects       int
+
+	// reconnectBackoff is the first wait before resuming a lost monitor
+	// session, reconnectInitialBackoff when zero
+	reconnectBackoff time.Duration
+
+	streamOffset interface{}
+	streamUntil  *streamUntil
+
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+	runErr    error
 }
 
 type ConsumerStatus struct {
@@ -28,6 +53,8 @@ type ConsumerStatus struct {
 	FilteredMessages int
 	Complete         bool
 	Message          *rabbitmq.Delivery
+	// Gap is set once a lost monitor session has been resumed
+	Gap *Gap
 }
 
 func NewConsumer(cfg *config.Config) (*Consumer, error) {
@@ -36,33 +63,54 @@ func NewConsumer(cfg *config.Config) (*Consumer, error) {
 		return nil, errors.Join(errs...)
 	}
 
-	// Create connection with TLS support
-	var conn *rabbitmq.Conn
-	var err error
+	protoDecoder, err := protobuf.NewDecoder(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	if cfg.SkipTLSVerification {
-		tlsConfig := &tls.Config{InsecureSkipVerify: true}
-		conn, err = rabbitmq.NewConn(
-			cfg.RabbitMQURL,
-			rabbitmq.WithConnectionOptionsLogging,
-			rabbitmq.WithConnectionOptionsConfig(rabbitmq.Config{
-				TLSClientConfig: tlsConfig,
-			}),
-		)
-	} else {
-		conn, err = rabbitmq.NewConn(
-			cfg.RabbitMQURL,
-			rabbitmq.WithConnectionOptionsLogging,
-		)
+	codecs, err := model.NewCodecRegistry(cfg.AvroSchemas)
+	if err != nil {
+		return nil, err
+	}
+	if err := codecs.Validate(cfg.Codec); err != nil {
+		return nil, err
+	}
+
+	if err := validateConsumerOptions(cfg); err != nil {
+		return nil, err
+	}
+
+	conn, err := NewConnection(cfg)
+	if err != nil {
+		return nil, err
 	}
+	// Connect right away so a broker that cannot be reached is reported
+	// before anything else starts
+	ch, err := conn.Channel()
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
+		conn.Close()
+		return nil, err
 	}
+	ch.Close()
 
 	c := &Consumer{
 		conn:   conn,
 		config: cfg,
 		filter: msgFilter,
+		proto:  protoDecoder,
+		codecs: codecs,
+		out:    os.Stdout,
+	}
+
+	if cfg.Stream {
+		if c.streamOffset, err = parseStreamOffset(cfg.StreamOffset); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if c.streamUntil, err = parseStreamUntil(cfg.StreamUntil); err != nil {
+			conn.Close()
+			return nil, err
+		}
 	}
 
 	// Handle queue setup
@@ -73,8 +121,10 @@ func NewConsumer(cfg *config.Config) (*Consumer, error) {
 	return c, nil
 }
 
-// Consume starts consuming messages and returns a channel for status updates
-func (c *Consumer) Consume() (<-chan ConsumerStatus, error) {
+// Consume starts consuming messages and returns a channel for status updates.
+// Consuming stops when ctx is cancelled or the consumer is closed: deliveries
+// that were not handed over yet are requeued and the channel is closed.
+func (c *Consumer) Consume(ctx context.Context) (<-chan ConsumerStatus, error) {
 	statusCh := make(chan ConsumerStatus)
 
 	// Prepare consumer options
@@ -82,176 +132,405 @@ func (c *Consumer) Consume() (<-chan ConsumerStatus, error) {
 
 	// Handle queue creation - if no queue name is provided, create a temporary queue
 	queueName := c.config.Queue
-	if queueName == "" {
+	switch {
+	case queueName == "":
+		// Declared by subscribe, see runTemporary
+	case c.config.DeclareQueue:
+		// Explicitly requested: declare a durable queue with the given arguments
 		consumerOptions = append(consumerOptions,
-			rabbitmq.WithConsumerOptionsQueueAutoDelete,
-			rabbitmq.WithConsumerOptionsQueueExclusive,
+			rabbitmq.WithConsumerOptionsQueueDurable,
+			rabbitmq.WithConsumerOptionsQueueArgs(parseArgs(c.config.DeclareArgs)),
 		)
-		queueName = ""
-	} else {
-		// For named queues, make them durable to match existing queue configurations
+	default:
+		// Passive: only inspect an existing queue, never create or change it
 		consumerOptions = append(consumerOptions,
-			rabbitmq.WithConsumerOptionsQueueDurable,
+			rabbitmq.WithConsumerOptionsQueuePassive,
 		)
 	}
 
-	// Add routing keys if specified
-	for _, routingKey := range c.config.RoutingKeys {
-		consumerOptions = append(consumerOptions,
-			rabbitmq.WithConsumerOptionsRoutingKey(routingKey))
-	}
+	// Bound the deliveries in flight, streams must be read with a prefetch
+	consumerOptions = append(consumerOptions,
+		rabbitmq.WithConsumerOptionsQOSPrefetch(prefetch(c.config)),
+		rabbitmq.WithConsumerOptionsConsumerName(c.config.ConsumerTag),
+		withConsumerArgs(consumerArgs(c.config)),
+	)
 
-	// Add exchange configuration
-	if c.config.Exchange != "" {
+	if c.config.Stream {
 		consumerOptions = append(consumerOptions,
-			rabbitmq.WithConsumerOptionsExchangeName(c.config.Exchange),
+			withStreamOffset(c.streamOffset),
 		)
 	}
 
-	// Create consumer
-	consumer, err := rabbitmq.NewConsumer(
-		c.conn,
-		queueName,
-		consumerOptions...,
-	)
-	if err != nil {
-		close(statusCh)
-		return nil, fmt.Errorf("failed to create consumer: %v", err)
-	}
+	// Bindings change the broker topology, so they are only added for
+	// temporary or explicitly declared queues
+	if queueName == "" || c.config.DeclareQueue {
+		// Add routing keys if specified
+		for _, routingKey := range c.config.RoutingKeys {
+			consumerOptions = append(consumerOptions,
+				rabbitmq.WithConsumerOptionsRoutingKey(routingKey))
+		}
 
-	c.consumer = consumer
+		// Add exchange configuration
+		if c.config.Exchange != "" {
+			consumerOptions = append(consumerOptions,
+				rabbitmq.WithConsumerOptionsExchangeName(c.config.Exchange),
+			)
+		}
+	}
 
-	// Get queue message count after consumer is created (for no-ack mode with StopAfterConsume)
-	if !c.config.AutoAck && c.config.StopAfterConsume && queueName != "" {
-		// Get queue info to determine message count using amqp091-go directly
-		// Use the same TLS configuration as the main connection
-		var conn *amqp091.Connection
-		var err error
+	// Make sure a passive queue exists before consuming, so a typo gives a
+	// clear error instead of a failing consumer
+	if queueName != "" && (!c.config.DeclareQueue || (!c.config.AutoAck && c.config.StopAfterConsume)) {
+		messages, err := c.inspectQueue(queueName)
+		switch {
+		case err == nil:
+			c.totalMessages = messages
+		case c.config.DeclareQueue:
+			// The queue will be declared by the consumer, so it starts empty
+			c.totalMessages = 0
+		default:
+			close(statusCh)
+			return nil, err
+		}
 
-		if c.config.SkipTLSVerification {
-			// Configure TLS for secure connections with skip verification
-			tlsConfig := &tls.Config{InsecureSkipVerify: true}
-			conn, err = amqp091.DialTLS(c.config.RabbitMQURL, tlsConfig)
-		} else {
-			conn, err = amqp091.Dial(c.config.RabbitMQURL)
+		if !c.config.AutoAck && c.config.StopAfterConsume {
+			fmt.Fprintf(c.out, "📊 Queue has %d messages\n", c.totalMessages)
 		}
+	}
 
+	// A temporary queue is consumed by goq itself, so it can be declared
+	// again when the connection drops
+	var sub *subscription
+	if queueName == "" {
+		var err error
+		if sub, err = c.subscribe(); err != nil {
+			close(statusCh)
+			return nil, err
+		}
+		fmt.Fprintf(c.out, "✅ Temporary queue created: %s\n", sub.queue)
+	} else {
+		managed, err := c.conn.managedConn()
 		if err != nil {
 			close(statusCh)
-			return nil, fmt.Errorf("failed to connect for queue info: %v", err)
+			return nil, err
 		}
-		defer conn.Close()
-
-		ch, err := conn.Channel()
+		consumer, err := rabbitmq.NewConsumer(
+			managed,
+			queueName,
+			consumerOptions...,
+		)
 		if err != nil {
 			close(statusCh)
-			return nil, fmt.Errorf("failed to get channel for queue info: %v", err)
+			return nil, fmt.Errorf("failed to create consumer: %v", err)
 		}
-		defer ch.Close()
+		c.consumer = consumer
 
-		queue, err := ch.QueueInspect(queueName)
-		if err != nil {
-			// Queue might not exist yet, that's okay - we'll set totalMessages to 0
-			c.totalMessages = 0
-			fmt.Printf("📊 Queue %s not found or empty\n", queueName)
+		if c.config.Stream {
+			fmt.Fprintf(c.out, "✅ Reading stream: %s from offset %v\n", queueName, c.streamOffset)
 		} else {
-			c.totalMessages = queue.Messages
-			fmt.Printf("📊 Queue has %d messages\n", c.totalMessages)
+			fmt.Fprintf(c.out, "✅ Connected to queue: %s\n", queueName)
 		}
 	}
 
-	if queueName == "" {
-		fmt.Println("✅ Temporary queue created with random name (managed by go-rabbitmq)")
-	} else {
-		fmt.Printf("✅ Connected to queue: %s\n", queueName)
+	if queueName == "" || c.config.DeclareQueue {
+		if len(c.config.RoutingKeys) > 0 {
+			fmt.Fprintf(c.out, "✅ Bound to routing keys: %v\n", c.config.RoutingKeys)
+		}
+		if c.config.Exchange != "" {
+			fmt.Fprintf(c.out, "✅ Connected to exchange: %s\n", c.config.Exchange)
+		}
 	}
 
-	if len(c.config.RoutingKeys) > 0 {
-		fmt.Printf("✅ Bound to routing keys: %v\n", c.config.RoutingKeys)
-	}
-	if c.config.Exchange != "" {
-		fmt.Printf("✅ Connected to exchange: %s\n", c.config.Exchange)
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+
+	go func() {
+		<-ctx.Done()
+		c.closeConsumer()
+	}()
+
+	// send hands a status over to the reader unless consuming was cancelled
+	send := func(status ConsumerStatus) bool {
+		select {
+		case statusCh <- status:
+			return true
+		case <-ctx.Done():
+			return false
+		}
 	}
 
 	go func() {
+		defer close(c.done)
 		defer close(statusCh)
 		filteredCount := 0
 		messageCount := 0
+		untilReached := false
+
+		handle := func(d rabbitmq.Delivery) rabbitmq.Action {
+			if ctx.Err() != nil {
+				return rabbitmq.NackRequeue
+			}
+
+			// Reading a stream never removes messages, so every delivery is
+			// acked to keep the credit flowing
+			if c.config.Stream {
+				if untilReached {
+					return rabbitmq.Ack
+				}
+				if c.streamUntil.reached(d) {
+					if c.streamUntil.missingTimestamp(d) {
+						fmt.Fprintf(c.out, "⚠️  Stopping at offset %v: the message has no timestamp property to compare with --until\n", d.Headers["x-stream-offset"])
+					}
+					untilReached = true
+					send(ConsumerStatus{
+						TotalMessages:    c.totalMessages,
+						ConsumedMessages: c.consumedMessages,
+						FilteredMessages: filteredCount,
+						Complete:         true,
+					})
+					return rabbitmq.Ack
+				}
+			}
 
-		err := consumer.Run(func(d rabbitmq.Delivery) rabbitmq.Action {
 			c.consumedMessages++
 			messageCount++
 			var filteredMsg *rabbitmq.Delivery
 
+			c.decodeBody(&d.Delivery)
 			if c.filter.Filter(convertDelivery(&d)) {
 				filteredMsg = &d
 			} else {
 				filteredCount++
 			}
 
-			statusCh <- ConsumerStatus{
+			delivered := send(ConsumerStatus{
 				TotalMessages:    c.totalMessages,
 				ConsumedMessages: c.consumedMessages,
 				FilteredMessages: filteredCount,
 				Complete:         false,
 				Message:          filteredMsg,
+			})
+			if !delivered {
+				// Nobody is going to export this message, put it back
+				c.consumedMessages--
+				return rabbitmq.NackRequeue
 			}
 
 			// For no-ack mode with StopAfterConsume, stop when we've processed enough messages
 			if !c.config.AutoAck && c.config.StopAfterConsume && c.totalMessages > 0 && messageCount >= c.totalMessages {
-				statusCh <- ConsumerStatus{
+				send(ConsumerStatus{
 					TotalMessages:    c.totalMessages,
 					ConsumedMessages: c.consumedMessages,
 					FilteredMessages: filteredCount,
 					Complete:         true,
 					Message:          nil,
+				})
+				if c.config.Stream {
+					return rabbitmq.Ack
 				}
 				return rabbitmq.NackRequeue
 			}
 
-			if c.config.AutoAck {
+			if c.config.AutoAck || c.config.Stream {
 				return rabbitmq.Ack
 			}
 			return rabbitmq.NackRequeue
-		})
+		}
 
+		var err error
+		if sub != nil {
+			err = c.runTemporary(ctx, sub, handle, func(gap Gap) {
+				send(ConsumerStatus{
+					TotalMessages:    c.totalMessages,
+					ConsumedMessages: c.consumedMessages,
+					FilteredMessages: filteredCount,
+					Gap:              &gap,
+				})
+			})
+		} else {
+			err = c.consumer.Run(handle)
+		}
 		if err != nil {
-			fmt.Printf("Consumer error: %v\n", err)
+			c.runErr = err
 		}
 	}()
 
 	return statusCh, nil
 }
 
-// Close closes the consumer and connection
+// Err returns the error that stopped consuming, if any. It is only
+// meaningful once the status channel has been closed.
+func (c *Consumer) Err() error {
+	return c.runErr
+}
+
+// Close stops consuming, waits for the in-flight delivery to be settled and
+// closes the connection
 func (c *Consumer) Close() error {
-	if c.consumer != nil {
-		c.consumer.Close()
+	if c.cancel != nil {
+		c.cancel()
+		<-c.done
 	}
+	c.closeConsumer()
 	if c.conn != nil {
 		c.conn.Close()
 	}
 	return nil
 }
 
-// convertDelivery converts rabbitmq.Delivery to amqp.Delivery for compatibility with existing filter
+// closeConsumer closes the go-rabbitmq consumer exactly once
+func (c *Consumer) closeConsumer() {
+	c.closeOnce.Do(func() {
+		if c.consumer != nil {
+			c.consumer.Close()
+		}
+	})
+}
+
+// inspectQueue passively declares an existing queue and returns its message count
+func (c *Consumer) inspectQueue(queueName string) (int, error) {
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get channel for queue info: %v", err)
+	}
+	defer ch.Close()
+
+	queue, err := ch.QueueInspect(queueName)
+	if err != nil {
+		return 0, describeQueueError(c.config, queueName, err)
+	}
+	return queue.Messages, nil
+}
+
+// describeQueueError turns a missing queue into an actionable error
+func describeQueueError(cfg *config.Config, queueName string, err error) error {
+	var amqpErr *amqp091.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp091.NotFound {
+		return fmt.Errorf("queue %q does not exist in virtual host %q: check the queue name and --virtualhost, or pass --declare to create it", queueName, cfg.VirtualHost)
+	}
+	return fmt.Errorf("failed to inspect queue %s: %v", queueName, err)
+}
+
+// parseArgs converts key=value arguments into an AMQP table. Integers and
+// booleans are converted to their AMQP types, anything else stays a string.
+func parseArgs(args map[string]string) rabbitmq.Table {
+	table := rabbitmq.Table{}
+	for k, v := range args {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			table[k] = n
+		} else if b, err := strconv.ParseBool(v); err == nil {
+			table[k] = b
+		} else {
+			table[k] = v
+		}
+	}
+	return table
+}
+
+// decodeBody turns the body of a delivery into the payload filters and
+// exporters work on: decompressed, and converted to JSON when it is protobuf
+// or uses one of the registered codecs
+func (c *Consumer) decodeBody(d *amqp091.Delivery) {
+	c.decompress(d)
+
+	if c.proto != nil {
+		if typeName := c.proto.TypeFor(d.RoutingKey, d.Headers); typeName != "" {
+			decoded, err := c.proto.Decode(typeName, d.Body)
+			if err != nil {
+				log.Printf("Keeping message %d undecoded: %v", d.DeliveryTag, err)
+				return
+			}
+			// Record the type so replay encodes the body back with it
+			d.Headers = withHeader(d.Headers, protobuf.TypeHeader, typeName)
+			d.Body = decoded
+			return
+		}
+	}
+
+	if c.codecs == nil {
+		return
+	}
+	codec := c.codecs.Select(c.config.Codec, d.ContentType)
+	if codec == nil {
+		return
+	}
+	decoded, err := codec.Decode(d.Body)
+	if err != nil {
+		log.Printf("Keeping message %d undecoded: %v", d.DeliveryTag, err)
+		return
+	}
+
+	// Record the codec and writer schema so replay encodes with the same ones
+	d.Headers = withHeader(d.Headers, model.CodecHeader, codec.Name())
+	if schemas, ok := codec.(model.SchemaCodec); ok {
+		if schema, err := schemas.Schema(d.Body); err == nil {
+			d.Headers = withHeader(d.Headers, model.SchemaHeader, schema)
+		}
+	}
+	d.Body = decoded
+}
+
+// withHeader returns a copy of headers with name set to value. The headers
+// are copied, move forwards the delivery they belong to.
+func withHeader(headers amqp091.Table, name string, value interface{}) amqp091.Table {
+	copied := make(amqp091.Table, len(headers)+1)
+	for k, v := range headers {
+		copied[k] = v
+	}
+	copied[name] = value
+	return copied
+}
+
+// decompress replaces a compressed body with its payload so filters and
+// exporters see the real content, unless the compressed form was asked for.
+// The content-encoding is cleared to match the new body.
+func (c *Consumer) decompress(d *amqp091.Delivery) {
+	if c.config.KeepCompressed {
+		return
+	}
+
+	body, encoding, err := compression.Decompress(d.ContentEncoding, d.Body)
+	if err != nil {
+		log.Printf("Keeping message %d compressed: %v", d.DeliveryTag, err)
+		return
+	}
+	if encoding != "" {
+		d.Body = body
+		d.ContentEncoding = ""
+	}
+}
+
+// convertDelivery builds the filter input document of a delivery
 func convertDelivery(d *rabbitmq.Delivery) *amqpDelivery {
-	message := struct {
-		Headers    map[string]interface{} `json:"headers"`
-		Exchange   string                 `json:"exchange"`
-		RoutingKey string                 `json:"routingKey"`
-		Body       interface{}            `json:"body"`
-	}{
-		Headers:    convertHeaders(rabbitmq.Table(d.Headers)),
-		Exchange:   d.Exchange,
-		RoutingKey: d.RoutingKey,
-		Body:       parseBody(d.Body),
+	document := filter.Document{
+		Headers: convertHeaders(rabbitmq.Table(d.Headers)),
+		Properties: model.Properties{
+			ContentType:     d.ContentType,
+			ContentEncoding: d.ContentEncoding,
+			DeliveryMode:    d.DeliveryMode,
+			Priority:        d.Priority,
+			CorrelationID:   d.CorrelationId,
+			ReplyTo:         d.ReplyTo,
+			Expiration:      d.Expiration,
+			MessageID:       d.MessageId,
+			Type:            d.Type,
+			UserID:          d.UserId,
+			AppID:           d.AppId,
+			DeliveryTag:     d.DeliveryTag,
+			Redelivered:     d.Redelivered,
+			ConsumerTag:     d.ConsumerTag,
+		},
+		RoutingKey:  d.RoutingKey,
+		Exchange:    d.Exchange,
+		Redelivered: d.Redelivered,
+		Body:        parseBody(d.Body),
 	}
 
-	jsonBytes, _ := json.Marshal(message)
+	jsonBytes, _ := json.Marshal(document)
 
 	return &amqpDelivery{
-		Body: jsonBytes,
+		Body:    jsonBytes,
+		Payload: d.Body,
 	}
 }
 
@@ -278,10 +557,16 @@ func parseBody(body []byte) interface{} {
 
 // amqpDelivery is a minimal adapter to make rabbitmq.Delivery compatible with the existing filter
 type amqpDelivery struct {
-	Body []byte
+	Body    []byte
+	Payload []byte
 }
 
 // GetBody implements the MessageDelivery interface
 func (d *amqpDelivery) GetBody() []byte {
 	return d.Body
 }
+
+// GetPayload implements the MessageDelivery interface
+func (d *amqpDelivery) GetPayload() []byte {
+	return d.Payload
+}
@@ -0,0 +1,85 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/wagslane/go-rabbitmq"
+)
+
+// MoveStats summarises a move run
+type MoveStats struct {
+	Scanned int
+	Moved   int
+	Skipped int
+}
+
+// Move reads the messages currently in the queue with basic.get and hands the
+// ones that pass the filter to forward. A message is acked at the source only
+// after forward returned without error. Messages that do not match are held
+// unacked while the queue is scanned and released at the end, so they stay
+// where they are. In dry-run mode nothing is acked.
+//
+// Only the number of messages present when the scan starts are read, so
+// forwarding back into the same queue cannot loop.
+func (c *Consumer) Move(ctx context.Context, dryRun bool, forward func(context.Context, rabbitmq.Delivery) error) (MoveStats, error) {
+	var stats MoveStats
+
+	if c.config.Queue == "" {
+		return stats, errors.New("move requires a source queue")
+	}
+
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return stats, fmt.Errorf("failed to get channel for move: %v", err)
+	}
+	defer ch.Close()
+
+	queue, err := ch.QueueInspect(c.config.Queue)
+	if err != nil {
+		return stats, describeQueueError(c.config, c.config.Queue, err)
+	}
+	c.totalMessages = queue.Messages
+
+	// Release every message still held, whatever happens below
+	defer ch.Nack(0, true, true)
+
+	for stats.Scanned < c.totalMessages {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		d, ok, err := ch.Get(c.config.Queue, false)
+		if err != nil {
+			return stats, fmt.Errorf("failed to get message from queue %s: %v", c.config.Queue, err)
+		}
+		if !ok {
+			break
+		}
+		stats.Scanned++
+		c.consumedMessages++
+
+		delivery := rabbitmq.Delivery{Delivery: d}
+		// Match on the payload but forward the message as it was published
+		matched := delivery
+		c.decodeBody(&matched.Delivery)
+		if !c.filter.Filter(convertDelivery(&matched)) {
+			stats.Skipped++
+			continue
+		}
+
+		if err := forward(ctx, delivery); err != nil {
+			return stats, err
+		}
+
+		if !dryRun {
+			if err := ch.Ack(d.DeliveryTag, false); err != nil {
+				return stats, fmt.Errorf("failed to ack moved message: %v", err)
+			}
+		}
+		stats.Moved++
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,91 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+// Peek reads up to count messages from the head of the queue using basic.get.
+// Every delivery is held unacked on a single channel until the whole batch has
+// been read, and then all of them are released at once so the queue keeps its
+// original order. The returned channel is already filled and closed.
+// Cancelling ctx stops reading and releases whatever was read so far.
+func (c *Consumer) Peek(ctx context.Context, count int) (<-chan ConsumerStatus, error) {
+	if c.config.Queue == "" {
+		return nil, errors.New("peek requires a queue name")
+	}
+	if count <= 0 {
+		return nil, fmt.Errorf("invalid peek count: %d", count)
+	}
+
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel for peek: %v", err)
+	}
+	defer ch.Close()
+
+	deliveries := make([]amqp091.Delivery, 0, count)
+	for len(deliveries) < count {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		d, ok, err := ch.Get(c.config.Queue, false)
+		if err != nil {
+			// Closing the channel releases whatever was read so far
+			return nil, describeQueueError(c.config, c.config.Queue, err)
+		}
+		if !ok {
+			break
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	// Release the whole batch with a single multiple nack
+	if len(deliveries) > 0 {
+		last := deliveries[len(deliveries)-1]
+		if err := ch.Nack(last.DeliveryTag, true, true); err != nil {
+			return nil, fmt.Errorf("failed to release peeked messages: %v", err)
+		}
+	}
+
+	fmt.Fprintf(c.out, "✅ Peeked %d messages from queue: %s\n", len(deliveries), c.config.Queue)
+
+	c.totalMessages = len(deliveries)
+	statusCh := make(chan ConsumerStatus, len(deliveries)+1)
+	filteredCount := 0
+
+	for _, d := range deliveries {
+		c.consumedMessages++
+		delivery := rabbitmq.Delivery{Delivery: d}
+		var filteredMsg *rabbitmq.Delivery
+
+		c.decodeBody(&delivery.Delivery)
+		if c.filter.Filter(convertDelivery(&delivery)) {
+			filteredMsg = &delivery
+		} else {
+			filteredCount++
+		}
+
+		statusCh <- ConsumerStatus{
+			TotalMessages:    c.totalMessages,
+			ConsumedMessages: c.consumedMessages,
+			FilteredMessages: filteredCount,
+			Message:          filteredMsg,
+		}
+	}
+
+	statusCh <- ConsumerStatus{
+		TotalMessages:    c.totalMessages,
+		ConsumedMessages: c.consumedMessages,
+		FilteredMessages: filteredCount,
+		Complete:         true,
+	}
+	close(statusCh)
+
+	return statusCh, nil
+}
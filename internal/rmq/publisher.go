@@ -0,0 +1,234 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/marianozunino/goq/internal/model"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+// Publisher publishes exported messages back to RabbitMQ using publisher
+// confirms. Messages are published as mandatory: one that reaches no queue is
+// returned by the broker and reported as an error instead of being dropped.
+type Publisher struct {
+	conn    *Connection
+	ch      *amqp091.Channel
+	returns chan amqp091.Return
+	config  *config.Config
+}
+
+// NewPublisher creates a new Publisher in confirm mode
+func NewPublisher(cfg *config.Config) (*Publisher, error) {
+	conn, err := NewConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Publisher{conn: conn, config: cfg}
+	if err := p.openChannel(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// openChannel opens the confirm channel messages are published on. The
+// broker sends a return before the confirm of the same message, so one
+// message at a time is enough to tell which message was returned.
+func (p *Publisher) openChannel() error {
+	ch, err := p.conn.Channel()
+	if err != nil {
+		return err
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return fmt.Errorf("failed to put channel in confirm mode: %v", err)
+	}
+	p.ch = ch
+	p.returns = ch.NotifyReturn(make(chan amqp091.Return, 1))
+	return nil
+}
+
+// Publish sends the message to the given exchange and routing key and waits
+// for the broker to confirm it. Headers are always restored, the remaining
+// AMQP properties only when the message carries them.
+func (p *Publisher) Publish(ctx context.Context, msg model.Message, exchange, routingKey string) error {
+	body, err := msg.RawBody()
+	if err != nil {
+		return fmt.Errorf("failed to decode message body: %v", err)
+	}
+
+	return p.publish(ctx, body, routingKey, publishOptions(msg, exchange))
+}
+
+// PublishDelivery forwards a consumed delivery unchanged, with all its
+// headers and properties, to the given exchange and routing key and waits for
+// the broker to confirm it
+func (p *Publisher) PublishDelivery(ctx context.Context, d rabbitmq.Delivery, exchange, routingKey string) error {
+	return p.publish(ctx, d.Body, routingKey, deliveryPublishOptions(d, exchange))
+}
+
+func (p *Publisher) publish(ctx context.Context, body []byte, routingKey string, options []func(*rabbitmq.PublishOptions)) error {
+	// A channel closed by the broker, e.g. for a missing exchange, is
+	// replaced for the next message
+	if p.ch == nil || p.ch.IsClosed() {
+		if err := p.openChannel(); err != nil {
+			return err
+		}
+	}
+
+	// Drop a return left over from a message whose wait was cancelled
+	select {
+	case <-p.returns:
+	default:
+	}
+
+	o := &rabbitmq.PublishOptions{}
+	for _, option := range options {
+		option(o)
+	}
+
+	confirm, err := p.ch.PublishWithDeferredConfirmWithContext(ctx, o.Exchange, routingKey, true, false, publishing(o, body))
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %v", err)
+	}
+
+	ok, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for publisher confirm: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("message was nacked by the broker")
+	}
+
+	select {
+	case ret := <-p.returns:
+		return fmt.Errorf("message was returned by the broker (%s): no queue is bound to exchange %q with routing key %q", ret.ReplyText, ret.Exchange, ret.RoutingKey)
+	default:
+	}
+	return nil
+}
+
+// Close closes the publisher and connection
+func (p *Publisher) Close() error {
+	if p.ch != nil {
+		p.ch.Close()
+	}
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	return nil
+}
+
+// publishing converts go-rabbitmq publish options into an AMQP message
+func publishing(o *rabbitmq.PublishOptions, body []byte) amqp091.Publishing {
+	return amqp091.Publishing{
+		Headers:         amqp091.Table(o.Headers),
+		ContentType:     o.ContentType,
+		ContentEncoding: o.ContentEncoding,
+		DeliveryMode:    o.DeliveryMode,
+		Priority:        o.Priority,
+		CorrelationId:   o.CorrelationID,
+		ReplyTo:         o.ReplyTo,
+		Expiration:      o.Expiration,
+		MessageId:       o.MessageID,
+		Timestamp:       o.Timestamp,
+		Type:            o.Type,
+		UserId:          o.UserID,
+		AppId:           o.AppID,
+		Body:            body,
+	}
+}
+
+// publishOptions builds the go-rabbitmq publish options for a message
+func publishOptions(msg model.Message, exchange string) []func(*rabbitmq.PublishOptions) {
+	options := []func(*rabbitmq.PublishOptions){
+		rabbitmq.WithPublishOptionsExchange(exchange),
+	}
+
+	if len(msg.Headers) > 0 {
+		options = append(options, rabbitmq.WithPublishOptionsHeaders(toTable(msg.Headers)))
+	}
+
+	if msg.Timestamp != 0 {
+		options = append(options, rabbitmq.WithPublishOptionsTimestamp(time.Unix(msg.Timestamp, 0)))
+	}
+
+	if props := msg.Properties; props != nil {
+		options = append(options,
+			rabbitmq.WithPublishOptionsContentType(props.ContentType),
+			rabbitmq.WithPublishOptionsContentEncoding(props.ContentEncoding),
+			rabbitmq.WithPublishOptionsPriority(props.Priority),
+			rabbitmq.WithPublishOptionsCorrelationID(props.CorrelationID),
+			rabbitmq.WithPublishOptionsReplyTo(props.ReplyTo),
+			rabbitmq.WithPublishOptionsExpiration(props.Expiration),
+			rabbitmq.WithPublishOptionsMessageID(props.MessageID),
+			rabbitmq.WithPublishOptionsType(props.Type),
+			rabbitmq.WithPublishOptionsUserID(props.UserID),
+			rabbitmq.WithPublishOptionsAppID(props.AppID),
+			func(o *rabbitmq.PublishOptions) {
+				o.DeliveryMode = props.DeliveryMode
+			},
+		)
+	}
+
+	return options
+}
+
+// deliveryPublishOptions builds the go-rabbitmq publish options that copy
+// every header and property of a delivery
+func deliveryPublishOptions(d rabbitmq.Delivery, exchange string) []func(*rabbitmq.PublishOptions) {
+	return []func(*rabbitmq.PublishOptions){
+		rabbitmq.WithPublishOptionsExchange(exchange),
+		rabbitmq.WithPublishOptionsHeaders(rabbitmq.Table(d.Headers)),
+		rabbitmq.WithPublishOptionsContentType(d.ContentType),
+		rabbitmq.WithPublishOptionsContentEncoding(d.ContentEncoding),
+		rabbitmq.WithPublishOptionsPriority(d.Priority),
+		rabbitmq.WithPublishOptionsCorrelationID(d.CorrelationId),
+		rabbitmq.WithPublishOptionsReplyTo(d.ReplyTo),
+		rabbitmq.WithPublishOptionsExpiration(d.Expiration),
+		rabbitmq.WithPublishOptionsMessageID(d.MessageId),
+		rabbitmq.WithPublishOptionsTimestamp(d.Timestamp),
+		rabbitmq.WithPublishOptionsType(d.Type),
+		rabbitmq.WithPublishOptionsUserID(d.UserId),
+		rabbitmq.WithPublishOptionsAppID(d.AppId),
+		func(o *rabbitmq.PublishOptions) {
+			o.DeliveryMode = d.DeliveryMode
+		},
+	}
+}
+
+// toTable converts decoded JSON headers back into AMQP field values.
+// Nested objects become tables and integral numbers become integers.
+func toTable(headers map[string]interface{}) rabbitmq.Table {
+	table := make(rabbitmq.Table, len(headers))
+	for k, v := range headers {
+		table[k] = toFieldValue(v)
+	}
+	return table
+}
+
+func toFieldValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return amqp091.Table(toTable(val))
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		for i, item := range val {
+			result[i] = toFieldValue(item)
+		}
+		return result
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < math.MaxInt64 {
+			return int64(val)
+		}
+		return val
+	default:
+		return val
+	}
+}
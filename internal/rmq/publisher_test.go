@@ -0,0 +1,100 @@
+package rmq
+
+import (
+	"testing"
+
+	"github.com/marianozunino/goq/internal/model"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+func TestToTable(t *testing.T) {
+	headers := map[string]interface{}{
+		"x-retry-count": float64(3),
+		"x-ratio":       1.5,
+		"x-tenant":      "acme",
+		"x-death": []interface{}{
+			map[string]interface{}{"count": float64(1), "queue": "orders"},
+		},
+	}
+
+	table := toTable(headers)
+
+	if table["x-retry-count"] != int64(3) {
+		t.Errorf("Expected integral number to become int64, got %T", table["x-retry-count"])
+	}
+
+	if table["x-ratio"] != 1.5 {
+		t.Errorf("Expected fractional number to stay float64, got %v", table["x-ratio"])
+	}
+
+	death, ok := table["x-death"].([]interface{})
+	if !ok || len(death) != 1 {
+		t.Fatalf("Expected x-death to be an array, got %T", table["x-death"])
+	}
+
+	if _, ok := death[0].(amqp091.Table); !ok {
+		t.Errorf("Expected nested object to become a table, got %T", death[0])
+	}
+
+	if err := amqp091.Table(table).Validate(); err != nil {
+		t.Errorf("Expected a valid AMQP table, got: %v", err)
+	}
+}
+
+func TestPublishOptions_WithProperties(t *testing.T) {
+	msg := model.Message{
+		Headers:   map[string]interface{}{"x-tenant": "acme"},
+		Timestamp: 1700000000,
+		Properties: &model.Properties{
+			ContentType:   "application/json",
+			DeliveryMode:  2,
+			CorrelationID: "corr-1",
+			MessageID:     "msg-1",
+		},
+	}
+
+	options := &rabbitmq.PublishOptions{}
+	for _, option := range publishOptions(msg, "orders") {
+		option(options)
+	}
+
+	if options.Exchange != "orders" {
+		t.Errorf("Expected exchange 'orders', got %s", options.Exchange)
+	}
+	if options.Headers["x-tenant"] != "acme" {
+		t.Errorf("Expected x-tenant header, got %v", options.Headers)
+	}
+	if options.Timestamp.Unix() != 1700000000 {
+		t.Errorf("Expected timestamp to be restored, got %v", options.Timestamp)
+	}
+	if options.ContentType != "application/json" || options.DeliveryMode != 2 {
+		t.Error("Expected content type and delivery mode to be restored")
+	}
+	if options.CorrelationID != "corr-1" || options.MessageID != "msg-1" {
+		t.Error("Expected correlation and message IDs to be restored")
+	}
+}
+
+func TestDeliveryPublishOptions(t *testing.T) {
+	var d rabbitmq.Delivery
+	d.Headers = amqp091.Table{"x-tenant": "acme"}
+	d.ContentType = "application/json"
+	d.DeliveryMode = 2
+	d.MessageId = "msg-1"
+
+	options := &rabbitmq.PublishOptions{}
+	for _, option := range deliveryPublishOptions(d, "orders") {
+		option(options)
+	}
+
+	if options.Exchange != "orders" {
+		t.Errorf("Expected exchange 'orders', got %s", options.Exchange)
+	}
+	if options.Headers["x-tenant"] != "acme" {
+		t.Errorf("Expected x-tenant header, got %v", options.Headers)
+	}
+	if options.ContentType != "application/json" || options.DeliveryMode != 2 || options.MessageID != "msg-1" {
+		t.Error("Expected delivery properties to be copied")
+	}
+}
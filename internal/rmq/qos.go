@@ -0,0 +1,67 @@
+package rmq
+
+import (
+	"fmt"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+// Prefetch used when --prefetch is not given
+const (
+	// peekPrefetch applies when messages are requeued after being read, so
+	// only a few are held back from other consumers at a time
+	peekPrefetch = 10
+	// drainPrefetch applies when messages are acked, so the broker can keep
+	// a large queue flowing without pushing it all at once
+	drainPrefetch = 250
+)
+
+// prefetch returns the QoS prefetch of the consumer: --prefetch when given,
+// otherwise a default that depends on how the messages are settled
+func prefetch(cfg *config.Config) int {
+	switch {
+	case cfg.Prefetch > 0:
+		return cfg.Prefetch
+	case cfg.Stream:
+		return streamPrefetch
+	case cfg.AutoAck:
+		return drainPrefetch
+	default:
+		return peekPrefetch
+	}
+}
+
+// consumerArgs returns the basic.consume arguments: --consumer-arg, with
+// --consumer-priority as x-priority
+func consumerArgs(cfg *config.Config) rabbitmq.Table {
+	args := parseArgs(cfg.ConsumerArgs)
+	if cfg.ConsumerPriority != 0 {
+		args["x-priority"] = int64(cfg.ConsumerPriority)
+	}
+	return args
+}
+
+// validateConsumerOptions checks the QoS and consumer options of cfg
+func validateConsumerOptions(cfg *config.Config) error {
+	if cfg.Prefetch < 0 {
+		return fmt.Errorf("invalid prefetch %d: must not be negative (0 picks the default)", cfg.Prefetch)
+	}
+	if cfg.Prefetch > 65535 {
+		return fmt.Errorf("invalid prefetch %d: must be at most 65535", cfg.Prefetch)
+	}
+	return nil
+}
+
+// withConsumerArgs adds args to the consumer arguments, keeping the ones set
+// by other options such as the stream offset
+func withConsumerArgs(args rabbitmq.Table) func(*rabbitmq.ConsumerOptions) {
+	return func(options *rabbitmq.ConsumerOptions) {
+		if options.RabbitConsumerOptions.Args == nil {
+			options.RabbitConsumerOptions.Args = rabbitmq.Table{}
+		}
+		for k, v := range args {
+			options.RabbitConsumerOptions.Args[k] = v
+		}
+	}
+}
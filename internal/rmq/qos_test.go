@@ -0,0 +1,72 @@
+package rmq
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+func TestPrefetch(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		expected int
+	}{
+		{name: "peek-like dump", cfg: &config.Config{}, expected: peekPrefetch},
+		{name: "draining dump", cfg: &config.Config{AutoAck: true}, expected: drainPrefetch},
+		{name: "stream", cfg: &config.Config{Stream: true}, expected: streamPrefetch},
+		{name: "flag", cfg: &config.Config{AutoAck: true, Prefetch: 1000}, expected: 1000},
+		{name: "flag on stream", cfg: &config.Config{Stream: true, Prefetch: 5}, expected: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prefetch(tt.cfg); got != tt.expected {
+				t.Errorf("Expected prefetch %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestConsumerArgs(t *testing.T) {
+	args := consumerArgs(&config.Config{
+		ConsumerPriority: 10,
+		ConsumerArgs:     map[string]string{"x-priority": "1", "x-cancel-on-ha-failover": "true"},
+	})
+
+	if args["x-priority"] != int64(10) {
+		t.Errorf("Expected --consumer-priority to set x-priority, got %v", args["x-priority"])
+	}
+	if args["x-cancel-on-ha-failover"] != true {
+		t.Errorf("Expected the consumer argument to be converted, got %v", args["x-cancel-on-ha-failover"])
+	}
+
+	if args := consumerArgs(&config.Config{}); len(args) != 0 {
+		t.Errorf("Expected no consumer arguments by default, got %v", args)
+	}
+}
+
+func TestWithConsumerArgs(t *testing.T) {
+	options := rabbitmq.ConsumerOptions{}
+	withStreamOffset("first")(&options)
+	withConsumerArgs(rabbitmq.Table{"x-priority": int64(5)})(&options)
+
+	args := options.RabbitConsumerOptions.Args
+	if args["x-stream-offset"] != "first" || args["x-priority"] != int64(5) {
+		t.Errorf("Expected the stream offset and consumer arguments together, got %v", args)
+	}
+}
+
+func TestValidateConsumerOptions(t *testing.T) {
+	if err := validateConsumerOptions(&config.Config{Prefetch: 100}); err != nil {
+		t.Errorf("Expected a valid prefetch, got %v", err)
+	}
+	for _, n := range []int{-1, 70000} {
+		err := validateConsumerOptions(&config.Config{Prefetch: n})
+		if err == nil || !strings.Contains(err.Error(), "invalid prefetch") {
+			t.Errorf("Expected prefetch %d to be rejected, got %v", n, err)
+		}
+	}
+}
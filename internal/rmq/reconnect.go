@@ -0,0 +1,178 @@
+package rmq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+// Backoff between attempts to get a lost monitor session back
+const (
+	reconnectInitialBackoff = time.Second
+	reconnectMaxBackoff     = 30 * time.Second
+)
+
+// GapRoutingKey is the routing key of the marker records written for an
+// outage, so they can be told apart from messages in the export
+const GapRoutingKey = "goq.gap"
+
+// GapHeader marks the gap records, replay skips them
+const GapHeader = "x-goq-gap"
+
+// Gap is an outage of a monitor session: messages published while the
+// connection was down were not seen
+type Gap struct {
+	Start      time.Time
+	End        time.Time
+	Reconnects int
+}
+
+// Duration returns how long the session was down
+func (g Gap) Duration() time.Duration {
+	return g.End.Sub(g.Start)
+}
+
+// Delivery returns the marker record of the gap: a delivery with the gap
+// routing key and the outage as JSON body, so every writer can export it
+func (g Gap) Delivery() rabbitmq.Delivery {
+	body, _ := json.Marshal(map[string]interface{}{
+		"gap": map[string]interface{}{
+			"start":      g.Start.UTC().Format(time.RFC3339Nano),
+			"end":        g.End.UTC().Format(time.RFC3339Nano),
+			"durationMs": g.Duration().Milliseconds(),
+			"reconnects": g.Reconnects,
+		},
+	})
+
+	var d rabbitmq.Delivery
+	d.RoutingKey = GapRoutingKey
+	d.Timestamp = g.End
+	d.ContentType = "application/json"
+	d.Headers = amqp091.Table{GapHeader: true}
+	d.Body = body
+	return d
+}
+
+// subscription is the temporary queue of a monitor session and the channel
+// consuming from it
+type subscription struct {
+	ch         *amqp091.Channel
+	queue      string
+	deliveries <-chan amqp091.Delivery
+}
+
+// subscribe declares a temporary queue, binds it to the routing keys and
+// starts consuming from it with the configured prefetch, tag and arguments
+func (c *Consumer) subscribe() (*subscription, error) {
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	queue, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to declare temporary queue: %v", err)
+	}
+
+	for _, routingKey := range c.config.RoutingKeys {
+		if err := ch.QueueBind(queue.Name, routingKey, c.config.Exchange, false, nil); err != nil {
+			ch.Close()
+			return nil, fmt.Errorf("failed to bind routing key %s: %v", routingKey, err)
+		}
+	}
+
+	if err := ch.Qos(prefetch(c.config), 0, false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to set prefetch: %v", err)
+	}
+
+	deliveries, err := ch.Consume(queue.Name, c.config.ConsumerTag, c.config.AutoAck, true, false, false, amqp091.Table(consumerArgs(c.config)))
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to consume from temporary queue: %v", err)
+	}
+
+	return &subscription{ch: ch, queue: queue.Name, deliveries: deliveries}, nil
+}
+
+// runTemporary consumes a monitor session until ctx is cancelled. A
+// temporary queue and its bindings go away with the connection, so when it
+// drops the queue is declared again, retrying with a growing backoff, and
+// the outage is reported to gap.
+func (c *Consumer) runTemporary(ctx context.Context, sub *subscription, handle rabbitmq.Handler, gap func(Gap)) error {
+	for {
+		c.consume(ctx, sub, handle)
+		sub.ch.Close()
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		start := time.Now()
+		fmt.Fprintf(c.out, "⚠️  Connection lost, reconnecting...\n")
+
+		var err error
+		if sub, err = c.resubscribe(ctx); err != nil {
+			return nil
+		}
+
+		c.reconnects++
+		fmt.Fprintf(c.out, "✅ Reconnected after %s, temporary queue declared again: %s\n", time.Since(start).Round(time.Millisecond), sub.queue)
+		gap(Gap{Start: start, End: time.Now(), Reconnects: c.reconnects})
+	}
+}
+
+// consume hands the deliveries of sub to handle until the channel closes or
+// ctx is cancelled
+func (c *Consumer) consume(ctx context.Context, sub *subscription, handle rabbitmq.Handler) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d, ok := <-sub.deliveries:
+			if !ok {
+				return
+			}
+			action := handle(rabbitmq.Delivery{Delivery: d})
+			if c.config.AutoAck {
+				continue
+			}
+			switch action {
+			case rabbitmq.Ack:
+				d.Ack(false)
+			case rabbitmq.NackDiscard:
+				d.Nack(false, false)
+			case rabbitmq.NackRequeue:
+				d.Nack(false, true)
+			}
+		}
+	}
+}
+
+// resubscribe subscribes again, backing off between attempts, until it
+// succeeds or ctx is cancelled
+func (c *Consumer) resubscribe(ctx context.Context) (*subscription, error) {
+	backoff := c.reconnectBackoff
+	if backoff <= 0 {
+		backoff = reconnectInitialBackoff
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		sub, err := c.subscribe()
+		if err == nil {
+			return sub, nil
+		}
+		backoff = min(backoff*2, reconnectMaxBackoff)
+		fmt.Fprintf(c.out, "⚠️  Reconnect failed, retrying in %s: %v\n", backoff, err)
+	}
+}
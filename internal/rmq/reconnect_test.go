@@ -0,0 +1,117 @@
+package rmq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+func TestGap_Delivery(t *testing.T) {
+	start := time.Date(2024, 3, 9, 14, 5, 7, 0, time.UTC)
+	gap := Gap{Start: start, End: start.Add(2500 * time.Millisecond), Reconnects: 2}
+
+	d := gap.Delivery()
+	if d.RoutingKey != GapRoutingKey || d.Headers["x-goq-gap"] != true {
+		t.Errorf("Expected a delivery marked as gap, got routing key %q and headers %v", d.RoutingKey, d.Headers)
+	}
+	if !d.Timestamp.Equal(gap.End) {
+		t.Errorf("Expected the gap end as timestamp, got %v", d.Timestamp)
+	}
+
+	var body struct {
+		Gap struct {
+			Start      string `json:"start"`
+			End        string `json:"end"`
+			DurationMs int64  `json:"durationMs"`
+			Reconnects int    `json:"reconnects"`
+		} `json:"gap"`
+	}
+	if err := json.Unmarshal(d.Body, &body); err != nil {
+		t.Fatalf("Expected a JSON body, got %s: %v", d.Body, err)
+	}
+	if body.Gap.Start != "2024-03-09T14:05:07Z" || body.Gap.End != "2024-03-09T14:05:09.5Z" {
+		t.Errorf("Expected the outage bounds, got %+v", body.Gap)
+	}
+	if body.Gap.DurationMs != 2500 || body.Gap.Reconnects != 2 {
+		t.Errorf("Expected a 2500ms outage and 2 reconnects, got %+v", body.Gap)
+	}
+}
+
+func TestConsumer_ConsumeUntilChannelCloses(t *testing.T) {
+	deliveries := make(chan amqp091.Delivery, 3)
+	for _, key := range []string{"a", "b", "c"} {
+		deliveries <- amqp091.Delivery{RoutingKey: key}
+	}
+	close(deliveries)
+
+	c := &Consumer{config: &config.Config{AutoAck: true}}
+	var seen []string
+	c.consume(context.Background(), &subscription{deliveries: deliveries}, func(d rabbitmq.Delivery) rabbitmq.Action {
+		seen = append(seen, d.RoutingKey)
+		return rabbitmq.Ack
+	})
+
+	if strings.Join(seen, ",") != "a,b,c" {
+		t.Errorf("Expected every delivery in order, got %v", seen)
+	}
+}
+
+func TestConsumer_ConsumeStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c := &Consumer{config: &config.Config{AutoAck: true}}
+	done := make(chan struct{})
+	go func() {
+		c.consume(ctx, &subscription{deliveries: make(chan amqp091.Delivery)}, func(rabbitmq.Delivery) rabbitmq.Action {
+			return rabbitmq.Ack
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected consuming to stop once cancelled")
+	}
+}
+
+func TestConsumer_ResubscribeBacksOff(t *testing.T) {
+	// Reserve a port nothing listens on, as a broker that is still down
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	cfg := &config.Config{RabbitMQURL: "amqp://" + addr + "/%2F"}
+	conn, err := NewConnection(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err)
+	}
+	defer conn.Close()
+
+	var out bytes.Buffer
+	c := &Consumer{conn: conn, config: cfg, out: &out, reconnectBackoff: 10 * time.Millisecond}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.resubscribe(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected to give up once cancelled, got %v", err)
+	}
+	for _, wait := range []string{"retrying in 20ms", "retrying in 40ms"} {
+		if !strings.Contains(out.String(), wait) {
+			t.Errorf("Expected the backoff to grow (%s), got:\n%s", wait, out.String())
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package rmq
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/wagslane/go-rabbitmq"
+)
+
+// streamPrefetch is the QoS prefetch used for stream consumers, which
+// RabbitMQ requires to be set
+const streamPrefetch = 100
+
+// streamUntil describes where reading a stream should stop
+type streamUntil struct {
+	offset    int64
+	hasOffset bool
+	timestamp time.Time
+}
+
+// parseStreamOffset converts the --offset value into the x-stream-offset
+// consumer argument: first, last, next, an absolute offset or an RFC 3339
+// timestamp
+func parseStreamOffset(offset string) (interface{}, error) {
+	switch offset {
+	case "", "next":
+		return "next", nil
+	case "first", "last":
+		return offset, nil
+	}
+
+	if n, err := strconv.ParseInt(offset, 10, 64); err == nil {
+		if n < 0 {
+			return nil, fmt.Errorf("invalid stream offset %d: must not be negative", n)
+		}
+		return n, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, offset); err == nil {
+		return t, nil
+	}
+
+	return nil, fmt.Errorf("invalid stream offset %q (use first, last, next, an offset or an RFC 3339 timestamp)", offset)
+}
+
+// parseStreamUntil converts the --until value, an offset or an RFC 3339
+// timestamp, into a stop condition. An empty value means read forever.
+func parseStreamUntil(until string) (*streamUntil, error) {
+	if until == "" {
+		return nil, nil
+	}
+
+	if n, err := strconv.ParseInt(until, 10, 64); err == nil {
+		return &streamUntil{offset: n, hasOffset: true}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, until); err == nil {
+		return &streamUntil{timestamp: t}, nil
+	}
+
+	return nil, fmt.Errorf("invalid stream until %q (use an offset or an RFC 3339 timestamp)", until)
+}
+
+// reached reports whether the delivery lies past the stop condition. Offsets
+// come from the x-stream-offset header, timestamps from the timestamp
+// property set by the publisher: the stream does not expose when a message
+// was stored, so a delivery without the property stops the read rather than
+// reading forever.
+func (u *streamUntil) reached(d rabbitmq.Delivery) bool {
+	if u == nil {
+		return false
+	}
+
+	if u.hasOffset {
+		offset, ok := d.Headers["x-stream-offset"].(int64)
+		return ok && offset > u.offset
+	}
+
+	return u.missingTimestamp(d) || d.Timestamp.After(u.timestamp)
+}
+
+// missingTimestamp reports whether a timestamp stop condition cannot be
+// checked because the delivery has no timestamp property
+func (u *streamUntil) missingTimestamp(d rabbitmq.Delivery) bool {
+	return u != nil && !u.hasOffset && d.Timestamp.IsZero()
+}
+
+// withStreamOffset sets the x-stream-offset consumer argument
+func withStreamOffset(offset interface{}) func(*rabbitmq.ConsumerOptions) {
+	return func(options *rabbitmq.ConsumerOptions) {
+		if options.RabbitConsumerOptions.Args == nil {
+			options.RabbitConsumerOptions.Args = rabbitmq.Table{}
+		}
+		options.RabbitConsumerOptions.Args["x-stream-offset"] = offset
+	}
+}
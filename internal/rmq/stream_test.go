@@ -0,0 +1,118 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wagslane/go-rabbitmq"
+)
+
+func TestParseStreamOffset(t *testing.T) {
+	timestamp := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		offset   string
+		expected interface{}
+		wantErr  bool
+	}{
+		{offset: "", expected: "next"},
+		{offset: "first", expected: "first"},
+		{offset: "last", expected: "last"},
+		{offset: "next", expected: "next"},
+		{offset: "42", expected: int64(42)},
+		{offset: "2024-06-01T00:00:00Z", expected: timestamp},
+		{offset: "-1", wantErr: true},
+		{offset: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		result, err := parseStreamOffset(tt.offset)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Expected error for offset %q", tt.offset)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for offset %q: %v", tt.offset, err)
+			continue
+		}
+		if ts, ok := tt.expected.(time.Time); ok {
+			if !ts.Equal(result.(time.Time)) {
+				t.Errorf("Expected timestamp %v, got %v", ts, result)
+			}
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("Expected offset %v for %q, got %v", tt.expected, tt.offset, result)
+		}
+	}
+}
+
+func TestStreamUntil_Offset(t *testing.T) {
+	until, err := parseStreamUntil("10")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var d rabbitmq.Delivery
+	d.Headers = amqp091.Table{"x-stream-offset": int64(10)}
+	if until.reached(d) {
+		t.Error("Expected offset 10 to be included")
+	}
+
+	d.Headers = amqp091.Table{"x-stream-offset": int64(11)}
+	if !until.reached(d) {
+		t.Error("Expected offset 11 to stop the read")
+	}
+}
+
+func TestStreamUntil_Timestamp(t *testing.T) {
+	until, err := parseStreamUntil("2024-06-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var d rabbitmq.Delivery
+	if !until.reached(d) || !until.missingTimestamp(d) {
+		t.Error("Expected a delivery without timestamp to stop the read instead of reading forever")
+	}
+
+	d.Timestamp = time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)
+	if until.reached(d) {
+		t.Error("Expected earlier timestamp to be included")
+	}
+
+	d.Timestamp = time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)
+	if !until.reached(d) {
+		t.Error("Expected later timestamp to stop the read")
+	}
+	if until.missingTimestamp(d) {
+		t.Error("Expected the timestamp to be found")
+	}
+}
+
+func TestStreamUntil_Empty(t *testing.T) {
+	until, err := parseStreamUntil("")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if until.reached(rabbitmq.Delivery{}) {
+		t.Error("Expected no stop condition")
+	}
+
+	if _, err := parseStreamUntil("soon"); err == nil {
+		t.Error("Expected error for invalid until value")
+	}
+}
+
+func TestWithStreamOffset(t *testing.T) {
+	options := &rabbitmq.ConsumerOptions{}
+	withStreamOffset("first")(options)
+
+	if options.RabbitConsumerOptions.Args["x-stream-offset"] != "first" {
+		t.Errorf("Expected x-stream-offset argument, got %v", options.RabbitConsumerOptions.Args)
+	}
+}
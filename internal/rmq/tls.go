@@ -0,0 +1,131 @@
+package rmq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/marianozunino/goq/internal/config"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// tlsSettings are the options a TLS configuration is built from
+type tlsSettings struct {
+	ca, cert, key, serverName string
+	insecure                  bool
+}
+
+// tlsConfigs holds the TLS configurations already built, so the consumer,
+// publisher and inspect connections share one and certificates are read once
+var (
+	tlsConfigsMu sync.Mutex
+	tlsConfigs   = map[tlsSettings]*tls.Config{}
+)
+
+// connectionConfig returns the configuration every broker connection is
+// opened with: the shared TLS configuration and the SASL mechanism
+func connectionConfig(cfg *config.Config) (amqp091.Config, error) {
+	connCfg := amqp091.Config{Locale: "en_US"}
+
+	uri, err := amqp091.ParseURI(cfg.RabbitMQURL)
+	if err != nil {
+		// Parse errors quote the URL, password included
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return connCfg, fmt.Errorf("invalid RabbitMQ URL: %v", err)
+	}
+
+	hasClientTLS := cfg.TLSCA != "" || cfg.TLSCert != "" || cfg.TLSKey != "" || cfg.TLSServerName != ""
+	if uri.Scheme != "amqps" {
+		if hasClientTLS {
+			return connCfg, fmt.Errorf("TLS options need a secure connection, use --secure or an amqps:// URI")
+		}
+	} else if hasClientTLS || cfg.SkipTLSVerification {
+		settings := tlsSettings{
+			ca:         cfg.TLSCA,
+			cert:       cfg.TLSCert,
+			key:        cfg.TLSKey,
+			serverName: cfg.TLSServerName,
+			insecure:   cfg.SkipTLSVerification,
+		}
+		// amqp091 fills in a missing server name on the configuration it is
+		// given, set it here so the shared configuration is never modified
+		if settings.serverName == "" {
+			settings.serverName = uri.Host
+		}
+		if connCfg.TLSClientConfig, err = sharedTLSConfig(settings); err != nil {
+			return connCfg, err
+		}
+	}
+
+	switch strings.ToLower(cfg.AuthMechanism) {
+	case config.AuthMechanismPlain, "":
+	case config.AuthMechanismExternal:
+		if uri.Scheme != "amqps" || cfg.TLSCert == "" {
+			return connCfg, fmt.Errorf("the external auth mechanism needs a secure connection and a client certificate (--tls-cert and --tls-key)")
+		}
+		connCfg.SASL = []amqp091.Authentication{&amqp091.ExternalAuth{}}
+	default:
+		return connCfg, fmt.Errorf("invalid auth mechanism: %s (use %s or %s)", cfg.AuthMechanism, config.AuthMechanismPlain, config.AuthMechanismExternal)
+	}
+
+	return connCfg, nil
+}
+
+// sharedTLSConfig returns the TLS configuration of settings, building it on
+// first use
+func sharedTLSConfig(settings tlsSettings) (*tls.Config, error) {
+	tlsConfigsMu.Lock()
+	defer tlsConfigsMu.Unlock()
+
+	if tlsConfig, ok := tlsConfigs[settings]; ok {
+		return tlsConfig, nil
+	}
+	tlsConfig, err := newTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfigs[settings] = tlsConfig
+	return tlsConfig, nil
+}
+
+// newTLSConfig loads the CA bundle and the client certificate of settings
+func newTLSConfig(settings tlsSettings) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         settings.serverName,
+		InsecureSkipVerify: settings.insecure,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if settings.ca != "" {
+		pem, err := os.ReadFile(settings.ca)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in TLS CA bundle %s", settings.ca)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	switch {
+	case settings.cert != "" && settings.key != "":
+		cert, err := tls.LoadX509KeyPair(settings.cert, settings.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case settings.cert != "" || settings.key != "":
+		return nil, fmt.Errorf("a TLS client certificate needs both --tls-cert and --tls-key")
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,73 @@
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// OrderType is the protobuf message type written by WriteOrderDescriptorSet
+const OrderType = "com.acme.Order"
+
+// orderFile describes:
+//
+//	package com.acme;
+//	message Order { string id = 1; int32 quantity = 2; }
+var orderFile = &descriptorpb.FileDescriptorProto{
+	Name:    proto.String("order.proto"),
+	Package: proto.String("com.acme"),
+	Syntax:  proto.String("proto3"),
+	MessageType: []*descriptorpb.DescriptorProto{
+		{
+			Name: proto.String("Order"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("id"), JsonName: proto.String("id"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("quantity"), JsonName: proto.String("quantity"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			},
+		},
+	},
+}
+
+// WriteOrderDescriptorSet writes a descriptor set with the OrderType message
+// and returns its path
+func WriteOrderDescriptorSet(t *testing.T) string {
+	t.Helper()
+
+	data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{orderFile}})
+	if err != nil {
+		t.Fatalf("Failed to marshal descriptor set: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "order.pb")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Failed to write descriptor set: %v", err)
+	}
+	return path
+}
+
+// EncodeOrder builds a binary OrderType message
+func EncodeOrder(t *testing.T, id string, quantity int32) []byte {
+	t.Helper()
+
+	file, err := protodesc.NewFile(orderFile, nil)
+	if err != nil {
+		t.Fatalf("Failed to build file descriptor: %v", err)
+	}
+
+	md := file.Messages().ByName("Order")
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(md.Fields().ByName("id"), protoreflect.ValueOfString(id))
+	msg.Set(md.Fields().ByName("quantity"), protoreflect.ValueOfInt32(quantity))
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal order: %v", err)
+	}
+	return data
+}
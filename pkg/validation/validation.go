@@ -2,26 +2,38 @@ package validation
 
 import (
 	"fmt"
-	"net/url"
 	"regexp"
 	"strings"
 
+	"github.com/marianozunino/goq/internal/config"
 	"github.com/spf13/viper"
 )
 
 var (
-	ValidWriters   = []string{"file", "console"}
+	ValidWriters   = []string{"file", "console", "csv", "tsv", "sqlite"}
 	ValidFileModes = []string{"append", "overwrite"}
+
+	ValidOutputErrorModes = []string{config.OutputErrorsContinue, config.OutputErrorsFail}
+	ValidAuthMechanisms   = []string{config.AuthMechanismPlain, config.AuthMechanismExternal}
 )
 
 func ValidateInput() error {
+	if err := ValidatePublishInput(); err != nil {
+		return err
+	}
+	return validateWriter()
+}
+
+// ValidatePublishInput validates the connection and filter settings, for
+// commands that publish to RabbitMQ instead of writing an export
+func ValidatePublishInput() error {
 	if err := validateURL(); err != nil {
 		return err
 	}
 	if err := validateVirtualHost(); err != nil {
 		return err
 	}
-	if err := validateWriter(); err != nil {
+	if err := validateTLS(); err != nil {
 		return err
 	}
 	if err := validatePatterns(); err != nil {
@@ -34,15 +46,10 @@ func ValidateInput() error {
 }
 
 func validateURL() error {
-	urlStr := viper.GetString("url")
-	if urlStr == "" {
+	if viper.GetString("url") == "" && viper.GetString("uri") == "" {
 		return fmt.Errorf("RabbitMQ URL is required")
 	}
-	protocol := "amqp"
-	if viper.GetBool("secure") {
-		protocol = "amqps"
-	}
-	if _, err := url.Parse(fmt.Sprintf("%s://%s", protocol, urlStr)); err != nil {
+	if _, err := config.URIFromFlags(); err != nil {
 		return fmt.Errorf("invalid RabbitMQ URL: %v", err)
 	}
 	return nil
@@ -57,17 +64,80 @@ func validateVirtualHost() error {
 	return nil
 }
 
+// validateTLS checks the client certificate options, the certificates
+// themselves are loaded when connecting
+func validateTLS() error {
+	cert, key := viper.GetString("tls-cert"), viper.GetString("tls-key")
+	if (cert == "") != (key == "") {
+		return fmt.Errorf("a TLS client certificate needs both --tls-cert and --tls-key")
+	}
+
+	mechanism := strings.ToLower(viper.GetString("auth-mechanism"))
+	if mechanism != "" && !contains(ValidAuthMechanisms, mechanism) {
+		return fmt.Errorf("invalid auth mechanism '%s', must be one of: %v", mechanism, ValidAuthMechanisms)
+	}
+	if mechanism == config.AuthMechanismExternal && cert == "" {
+		return fmt.Errorf("the external auth mechanism needs a client certificate (--tls-cert and --tls-key)")
+	}
+
+	hasTLS := cert != "" || viper.GetString("tls-ca") != "" || viper.GetString("tls-server-name") != ""
+	if uri, err := config.URIFromFlags(); err == nil && hasTLS && !strings.HasPrefix(uri, "amqps://") {
+		return fmt.Errorf("TLS options need a secure connection, use --secure or an amqps:// URI")
+	}
+	return nil
+}
+
 func validateWriter() error {
-	writer := viper.GetString("writer")
-	if !contains(ValidWriters, writer) {
-		return fmt.Errorf("invalid writer type '%s', must be one of: %v", writer, ValidWriters)
+	if viper.IsSet("outputs") && !viper.IsSet("writer") {
+		return validateOutputs()
 	}
-	if writer == "file" && viper.GetString("output") == "" {
-		return fmt.Errorf("output file is required when using file writer")
+
+	for _, writer := range viper.GetStringSlice("writer") {
+		if err := checkWriter(writer, viper.GetString("output")); err != nil {
+			return err
+		}
 	}
 	if !contains(ValidFileModes, viper.GetString("file-mode")) {
 		return fmt.Errorf("invalid file mode '%s': must be one of: %v", viper.GetString("file-mode"), ValidFileModes)
 	}
+	if mode := viper.GetString("on-output-error"); mode != "" && !contains(ValidOutputErrorModes, mode) {
+		return fmt.Errorf("invalid output error mode '%s', must be one of: %v", mode, ValidOutputErrorModes)
+	}
+	return nil
+}
+
+// validateOutputs checks the outputs listed in the config file
+func validateOutputs() error {
+	var outputs []config.OutputConfig
+	if err := viper.UnmarshalKey("outputs", &outputs); err != nil {
+		return fmt.Errorf("invalid outputs in config file: %v", err)
+	}
+	if len(outputs) == 0 {
+		return fmt.Errorf("outputs in config file cannot be empty")
+	}
+
+	for i, out := range outputs {
+		output := out.Output
+		if output == "" {
+			output = viper.GetString("output")
+		}
+		if err := checkWriter(out.Writer, output); err != nil {
+			return fmt.Errorf("output %d: %v", i+1, err)
+		}
+		if out.FileMode != "" && !contains(ValidFileModes, out.FileMode) {
+			return fmt.Errorf("output %d: invalid file mode '%s': must be one of: %v", i+1, out.FileMode, ValidFileModes)
+		}
+	}
+	return nil
+}
+
+func checkWriter(writer, output string) error {
+	if !contains(ValidWriters, writer) {
+		return fmt.Errorf("invalid writer type '%s', must be one of: %v", writer, ValidWriters)
+	}
+	if (writer == "file" || writer == "sqlite") && output == "" {
+		return fmt.Errorf("output file is required when using %s writer", writer)
+	}
 	return nil
 }
 
@@ -4,6 +4,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/marianozunino/goq/internal/config"
 	"github.com/spf13/viper"
 )
 
@@ -61,6 +62,65 @@ func TestValidateInput_SecureURL(t *testing.T) {
 	}
 }
 
+func TestValidateInput_URI(t *testing.T) {
+	resetViper()
+	viper.Set("url", "")
+	viper.Set("uri", "amqps://admin@rabbit:5671/prod")
+	viper.Set(config.PasswordKey, "secret")
+
+	if err := ValidateInput(); err != nil {
+		t.Errorf("Unexpected error for URI: %v", err)
+	}
+
+	viper.Set("uri", "http://rabbit")
+	err := ValidateInput()
+	if err == nil || !strings.Contains(err.Error(), "invalid RabbitMQ URL") {
+		t.Errorf("Expected error for a non AMQP URI, got: %v", err)
+	}
+}
+
+func TestValidateInput_PasswordWithoutUser(t *testing.T) {
+	resetViper()
+	viper.Set(config.PasswordKey, "secret")
+
+	err := ValidateInput()
+	if err == nil || !strings.Contains(err.Error(), "needs a user") {
+		t.Errorf("Expected error for a password without user, got: %v", err)
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		err      string
+	}{
+		{name: "mutual TLS", settings: map[string]interface{}{"secure": true, "tls-ca": "ca.crt", "tls-cert": "client.crt", "tls-key": "client.key", "auth-mechanism": "external"}},
+		{name: "amqps URI", settings: map[string]interface{}{"uri": "amqps://rabbit/prod", "tls-ca": "ca.crt"}},
+		{name: "cert without key", settings: map[string]interface{}{"secure": true, "tls-cert": "client.crt"}, err: "both --tls-cert and --tls-key"},
+		{name: "unknown mechanism", settings: map[string]interface{}{"auth-mechanism": "kerberos"}, err: "invalid auth mechanism"},
+		{name: "external without certificate", settings: map[string]interface{}{"secure": true, "auth-mechanism": "EXTERNAL"}, err: "needs a client certificate"},
+		{name: "not secure", settings: map[string]interface{}{"tls-ca": "ca.crt"}, err: "--secure"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetViper()
+			for key, value := range tt.settings {
+				viper.Set(key, value)
+			}
+
+			err := ValidateInput()
+			if tt.err == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Expected error containing %q, got: %v", tt.err, err)
+			}
+		})
+	}
+}
+
 func TestValidateVirtualHost_Default(t *testing.T) {
 	// Test default virtual host
 	viper.Set("virtualhost", "/")
@@ -128,6 +188,70 @@ func TestValidateWriter_File(t *testing.T) {
 	}
 }
 
+func TestValidateWriter_CSV(t *testing.T) {
+	resetViper()
+	// CSV and TSV writers fall back to stdout without an output file
+	for _, writer := range []string{"csv", "tsv"} {
+		viper.Set("writer", writer)
+
+		if err := ValidateInput(); err != nil {
+			t.Errorf("Unexpected error for %s writer: %v", writer, err)
+		}
+	}
+}
+
+func TestValidateWriter_Repeated(t *testing.T) {
+	resetViper()
+	viper.Set("writer", []string{"console", "file"})
+
+	if err := ValidateInput(); err == nil || !strings.Contains(err.Error(), "output file is required") {
+		t.Errorf("Expected output file error for the file writer, got: %v", err)
+	}
+
+	viper.Set("output", "dump.json")
+	if err := ValidateInput(); err != nil {
+		t.Errorf("Unexpected error for repeated writers: %v", err)
+	}
+
+	viper.Set("on-output-error", "retry")
+	if err := ValidateInput(); err == nil || !strings.Contains(err.Error(), "invalid output error mode") {
+		t.Errorf("Expected output error mode error, got: %v", err)
+	}
+}
+
+func TestValidateWriter_Outputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		outputs []map[string]interface{}
+		err     string
+	}{
+		{name: "valid", outputs: []map[string]interface{}{{"writer": "console", "pretty-print": true}, {"writer": "file", "output": "dump.json"}}},
+		{name: "empty", outputs: []map[string]interface{}{}, err: "cannot be empty"},
+		{name: "invalid writer", outputs: []map[string]interface{}{{"writer": "kafka"}}, err: "output 1: invalid writer type"},
+		{name: "file without output", outputs: []map[string]interface{}{{"writer": "console"}, {"writer": "file"}}, err: "output 2: output file is required"},
+		{name: "invalid file mode", outputs: []map[string]interface{}{{"writer": "file", "output": "dump.json", "file-mode": "rotate"}}, err: "invalid file mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			viper.Set("url", "localhost:5672")
+			viper.Set("virtualhost", "/")
+			viper.Set("max-message-size", -1)
+			viper.Set("outputs", tt.outputs)
+
+			err := ValidateInput()
+			if tt.err == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Expected error containing %q, got: %v", tt.err, err)
+			}
+		})
+	}
+	resetViper()
+}
+
 func TestValidateWriter_Invalid(t *testing.T) {
 	resetViper()
 	// Test invalid writer
@@ -159,6 +283,17 @@ func TestValidateWriter_FileWithoutOutput(t *testing.T) {
 	}
 }
 
+func TestValidateWriter_SQLiteWithoutOutput(t *testing.T) {
+	resetViper()
+	viper.Set("writer", "sqlite")
+	viper.Set("output", "")
+
+	err := ValidateInput()
+	if err == nil || !strings.Contains(err.Error(), "output file is required when using sqlite writer") {
+		t.Errorf("Expected output file error for sqlite writer, got: %v", err)
+	}
+}
+
 func TestValidateWriter_InvalidFileMode(t *testing.T) {
 	resetViper()
 	// Test invalid file mode
@@ -314,6 +449,23 @@ func TestValidateInput_FileWriterWithOutput(t *testing.T) {
 }
 
 // Helper function to reset viper for each test
+func TestValidatePublishInput(t *testing.T) {
+	resetViper()
+	// The default file writer without --output does not matter when publishing
+	viper.Set("writer", "file")
+	viper.Set("output", "")
+
+	if err := ValidatePublishInput(); err != nil {
+		t.Errorf("Unexpected error for publish input: %v", err)
+	}
+
+	viper.Set("tls-cert", "client.pem")
+	err := ValidatePublishInput()
+	if err == nil || !strings.Contains(err.Error(), "--tls-key") {
+		t.Errorf("Expected the TLS settings to be validated, got: %v", err)
+	}
+}
+
 func resetViper() {
 	viper.Reset()
 	// Set some defaults to avoid issues